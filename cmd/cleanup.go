@@ -12,6 +12,8 @@ type CleanupCmdOpt struct {
 	ScheduledWorkflowTimeout      time.Duration
 	WorkflowActivationLockTimeout time.Duration
 	WorkflowSchedulerLockTimeout  time.Duration
+	DeletedWorkflowRetention      time.Duration
+	PurgeDryRun                   bool
 }
 
 func getCleanupCmdOpt() CleanupCmdOpt {
@@ -19,6 +21,8 @@ func getCleanupCmdOpt() CleanupCmdOpt {
 		ScheduledWorkflowTimeout:      viper.GetDuration("cleanup.scheduledWorkflow"),
 		WorkflowActivationLockTimeout: viper.GetDuration("cleanup.workflowActivationLock"),
 		WorkflowSchedulerLockTimeout:  viper.GetDuration("cleanup.workflowSchedulerLock"),
+		DeletedWorkflowRetention:      viper.GetDuration("cleanup.deletedWorkflow"),
+		PurgeDryRun:                   viper.GetBool("cleanup.purgeDryRun"),
 	}
 }
 
@@ -33,6 +37,8 @@ var cleanupCmd = &cobra.Command{
 			ScheduledWorkflowTimeout:      cleanupCmdOpt.ScheduledWorkflowTimeout,
 			WorkflowActivationLockTimeout: cleanupCmdOpt.WorkflowActivationLockTimeout,
 			WorkflowSchedulerLockTimeout:  cleanupCmdOpt.WorkflowSchedulerLockTimeout,
+			DeletedWorkflowRetention:      cleanupCmdOpt.DeletedWorkflowRetention,
+			PurgeDryRun:                   cleanupCmdOpt.PurgeDryRun,
 		}
 		cleanup.Run()
 	},
@@ -61,4 +67,18 @@ func init() {
 		"Workflow scheduleer lock TTL",
 	)
 	viper.BindPFlag("cleanup.workflowSchedulerLock", cleanupCmd.Flags().Lookup("workflowSchedulerLock"))
+
+	cleanupCmd.Flags().Duration(
+		"deletedWorkflow",
+		0,
+		"deleted workflows are purged with their runs, versions and locks once deleted for longer than this duration, 0 disables the purge",
+	)
+	viper.BindPFlag("cleanup.deletedWorkflow", cleanupCmd.Flags().Lookup("deletedWorkflow"))
+
+	cleanupCmd.Flags().Bool(
+		"purgeDryRun",
+		false,
+		"only report the deleted workflows that would be purged",
+	)
+	viper.BindPFlag("cleanup.purgeDryRun", cleanupCmd.Flags().Lookup("purgeDryRun"))
 }
@@ -7,6 +7,7 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -24,6 +25,7 @@ type ControlCmdOpt struct {
 	XfccEnabled     bool
 	XfccHeaderName  string
 	XfccMustContain string
+	ShutdownTimeout time.Duration
 }
 
 const (
@@ -41,6 +43,8 @@ const (
 	CtrlConfigTrustedProxy    string = "control.trustedProxies"
 	CtrlFlagAddress           string = "address"
 	CtrlConfigAddress         string = "control.address"
+	CtrlFlagShutdownTimeout   string = "shutdownTimeout"
+	CtrlConfigShutdownTimeout string = "control.shutdownTimeout"
 )
 
 func getControlCmdOpt() ControlCmdOpt {
@@ -54,6 +58,7 @@ func getControlCmdOpt() ControlCmdOpt {
 		XfccEnabled:     viper.GetBool(CtrlConfigXfccEnabled),
 		XfccHeaderName:  viper.GetString(CtrlConfigXfccHeaderName),
 		XfccMustContain: viper.GetString(CtrlConfigXfccMustContain),
+		ShutdownTimeout: viper.GetDuration(CtrlConfigShutdownTimeout),
 	}
 }
 
@@ -75,8 +80,20 @@ and run by sprinkler.`,
 			controlCmdOpt.XfccEnabled,
 			controlCmdOpt.XfccHeaderName,
 			controlCmdOpt.XfccMustContain,
+			// manual triggers create orchard workflows like the scheduler does
+			&service.Scheduler{
+				OrchardHost:       viper.GetString("scheduler.orchard.address"),
+				OrchardAPIKeyName: viper.GetString("scheduler.orchard.apiKeyName"),
+				OrchardAPIKey:     viper.GetString("scheduler.orchard.apiKey"),
+				// they take the workflow lock the same way too
+				ClaimMode:     viper.GetString("scheduler.claimMode"),
+				LeaseDuration: viper.GetDuration("scheduler.leaseDuration"),
+				LockTTL:       viper.GetDuration("scheduler.lockTTL"),
+			},
 		)
-		ctrl.Run()
+		ctx, stop := shutdownContext()
+		defer stop()
+		ctrl.Run(ctx, controlCmdOpt.ShutdownTimeout)
 	},
 }
 
@@ -108,4 +125,7 @@ func init() {
 	controlCmd.Flags().String(CtrlFlagXfccMustContain, "", "xfcc must contain")
 	viper.BindPFlag(CtrlConfigXfccMustContain, controlCmd.Flags().Lookup(CtrlFlagXfccMustContain))
 
+	controlCmd.Flags().Duration(CtrlFlagShutdownTimeout, 25*time.Second, "how long a shutdown waits for the requests in flight")
+	viper.BindPFlag(CtrlConfigShutdownTimeout, controlCmd.Flags().Lookup(CtrlFlagShutdownTimeout))
+
 }
@@ -6,6 +6,7 @@
 package cmd
 
 import (
+	"log"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -18,6 +19,19 @@ type SchedulerCmdOpt struct {
 	OrchardAddress    string
 	OrchardAPIKeyName string
 	OrchardAPIKey     string
+	MisfireThreshold  time.Duration
+	DependencyTimeout time.Duration
+	ReconcileInterval time.Duration
+	MaxSize           uint
+	GenerationWorkers uint
+	ActivationWorkers uint
+	Address           string
+	ClaimMode         string
+	LeaseDuration     time.Duration
+	LockTTL           time.Duration
+	LeaderLease       time.Duration
+	CleanupInterval   time.Duration
+	ShutdownTimeout   time.Duration
 }
 
 func getSchedulerCmdOpt() SchedulerCmdOpt {
@@ -26,6 +40,19 @@ func getSchedulerCmdOpt() SchedulerCmdOpt {
 		OrchardAddress:    viper.GetString("scheduler.orchard.address"),
 		OrchardAPIKeyName: viper.GetString("scheduler.orchard.apiKeyName"),
 		OrchardAPIKey:     viper.GetString("scheduler.orchard.apiKey"),
+		MisfireThreshold:  viper.GetDuration("scheduler.misfireThreshold"),
+		DependencyTimeout: viper.GetDuration("scheduler.dependencyTimeout"),
+		ReconcileInterval: viper.GetDuration("scheduler.reconcileInterval"),
+		MaxSize:           viper.GetUint("scheduler.maxSize"),
+		GenerationWorkers: viper.GetUint("scheduler.generationWorkers"),
+		ActivationWorkers: viper.GetUint("scheduler.activationWorkers"),
+		Address:           viper.GetString("scheduler.address"),
+		ClaimMode:         viper.GetString("scheduler.claimMode"),
+		LeaseDuration:     viper.GetDuration("scheduler.leaseDuration"),
+		LockTTL:           viper.GetDuration("scheduler.lockTTL"),
+		LeaderLease:       viper.GetDuration("scheduler.leaderLease"),
+		CleanupInterval:   viper.GetDuration("scheduler.cleanupInterval"),
+		ShutdownTimeout:   viper.GetDuration("scheduler.shutdownTimeout"),
 	}
 }
 
@@ -41,14 +68,39 @@ This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		schedulerCmdOpt := getSchedulerCmdOpt()
+		cleanupCmdOpt := getCleanupCmdOpt()
+		if !service.ValidClaimMode(schedulerCmdOpt.ClaimMode) {
+			log.Fatalf("Invalid claim mode %q, must be lock or lease", schedulerCmdOpt.ClaimMode)
+		}
 		scheduler := &service.Scheduler{
 			Interval:          schedulerCmdOpt.Interval,
-			MaxSize:           10,
+			MaxSize:           schedulerCmdOpt.MaxSize,
+			GenerationWorkers: schedulerCmdOpt.GenerationWorkers,
+			ActivationWorkers: schedulerCmdOpt.ActivationWorkers,
+			Address:           schedulerCmdOpt.Address,
 			OrchardHost:       schedulerCmdOpt.OrchardAddress,
 			OrchardAPIKeyName: schedulerCmdOpt.OrchardAPIKeyName,
 			OrchardAPIKey:     schedulerCmdOpt.OrchardAPIKey,
+			MisfireThreshold:  schedulerCmdOpt.MisfireThreshold,
+			DependencyTimeout: schedulerCmdOpt.DependencyTimeout,
+			ReconcileInterval: schedulerCmdOpt.ReconcileInterval,
+			ClaimMode:         schedulerCmdOpt.ClaimMode,
+			LeaseDuration:     schedulerCmdOpt.LeaseDuration,
+			LockTTL:           schedulerCmdOpt.LockTTL,
+			LeaderLease:       schedulerCmdOpt.LeaderLease,
+			CleanupInterval:   schedulerCmdOpt.CleanupInterval,
+			ShutdownTimeout:   schedulerCmdOpt.ShutdownTimeout,
+			Cleanup: &service.Cleanup{
+				ScheduledWorkflowTimeout:      cleanupCmdOpt.ScheduledWorkflowTimeout,
+				WorkflowActivationLockTimeout: cleanupCmdOpt.WorkflowActivationLockTimeout,
+				WorkflowSchedulerLockTimeout:  cleanupCmdOpt.WorkflowSchedulerLockTimeout,
+				DeletedWorkflowRetention:      cleanupCmdOpt.DeletedWorkflowRetention,
+				PurgeDryRun:                   cleanupCmdOpt.PurgeDryRun,
+			},
 		}
-		scheduler.Start()
+		ctx, stop := shutdownContext()
+		defer stop()
+		scheduler.Start(ctx)
 	},
 }
 
@@ -62,6 +114,97 @@ func init() {
 	)
 	viper.BindPFlag("scheduler.interval", schedulerCmd.Flags().Lookup("interval"))
 
+	schedulerCmd.Flags().Duration(
+		"misfireThreshold",
+		5*time.Minute,
+		"how late a run can be picked up before its workflow misfire policy applies",
+	)
+	viper.BindPFlag("scheduler.misfireThreshold", schedulerCmd.Flags().Lookup("misfireThreshold"))
+
+	schedulerCmd.Flags().Duration(
+		"dependencyTimeout",
+		24*time.Hour,
+		"how long a run waits for its upstream runs to succeed",
+	)
+	viper.BindPFlag("scheduler.dependencyTimeout", schedulerCmd.Flags().Lookup("dependencyTimeout"))
+
+	schedulerCmd.Flags().Duration(
+		"reconcileInterval",
+		time.Minute,
+		"how often activated runs are checked in orchard, 0 disables it",
+	)
+	viper.BindPFlag("scheduler.reconcileInterval", schedulerCmd.Flags().Lookup("reconcileInterval"))
+
+	schedulerCmd.Flags().Uint(
+		"maxSize",
+		10,
+		"workers of the generation and activation pools unless set on their own",
+	)
+	viper.BindPFlag("scheduler.maxSize", schedulerCmd.Flags().Lookup("maxSize"))
+
+	schedulerCmd.Flags().Uint(
+		"generationWorkers",
+		0,
+		"workers running generator processes, 0 uses maxSize",
+	)
+	viper.BindPFlag("scheduler.generationWorkers", schedulerCmd.Flags().Lookup("generationWorkers"))
+
+	schedulerCmd.Flags().Uint(
+		"activationWorkers",
+		0,
+		"workers activating runs in orchard, 0 uses maxSize",
+	)
+	viper.BindPFlag("scheduler.activationWorkers", schedulerCmd.Flags().Lookup("activationWorkers"))
+
+	schedulerCmd.Flags().String(
+		"claimMode",
+		service.ClaimModeLock,
+		"how schedulers claim work: lock (lock tables) or lease (lease columns, renewed while held)",
+	)
+	viper.BindPFlag("scheduler.claimMode", schedulerCmd.Flags().Lookup("claimMode"))
+
+	schedulerCmd.Flags().Duration(
+		"leaseDuration",
+		time.Minute,
+		"how long a lease is held without being renewed in the lease claim mode",
+	)
+	viper.BindPFlag("scheduler.leaseDuration", schedulerCmd.Flags().Lookup("leaseDuration"))
+
+	schedulerCmd.Flags().Duration(
+		"lockTTL",
+		5*time.Minute,
+		"locks not refreshed for longer are taken over in the lock claim mode, 0 never takes them over",
+	)
+	viper.BindPFlag("scheduler.lockTTL", schedulerCmd.Flags().Lookup("lockTTL"))
+
+	schedulerCmd.Flags().Duration(
+		"leaderLease",
+		30*time.Second,
+		"how long the leader holds the leadership without renewing it, the others take it over after",
+	)
+	viper.BindPFlag("scheduler.leaderLease", schedulerCmd.Flags().Lookup("leaderLease"))
+
+	schedulerCmd.Flags().Duration(
+		"cleanupInterval",
+		0,
+		"how often the leader runs the cleanup sweep with the cleanup settings, 0 disables it",
+	)
+	viper.BindPFlag("scheduler.cleanupInterval", schedulerCmd.Flags().Lookup("cleanupInterval"))
+
+	schedulerCmd.Flags().Duration(
+		"shutdownTimeout",
+		25*time.Second,
+		"how long a shutdown waits for the runs being created and activated before canceling them, they then have 5s to stop and the locks they freed are released, the ones still held expire",
+	)
+	viper.BindPFlag("scheduler.shutdownTimeout", schedulerCmd.Flags().Lookup("shutdownTimeout"))
+
+	schedulerCmd.Flags().String(
+		"address",
+		":8083",
+		"address of the scheduler status and metrics endpoints, empty disables them",
+	)
+	viper.BindPFlag("scheduler.address", schedulerCmd.Flags().Lookup("address"))
+
 	schedulerCmd.Flags().String(
 		"orchardAddress",
 		"http://ws:8081",
@@ -6,10 +6,11 @@
 package common
 
 const (
-	DBConfigHost     string = "db.host"
-	DBConfigUser            = "db.user"
-	DBConfigPassword        = "db.password"
-	DBConfigDBName          = "db.dbname"
-	DBConfigSSLMode         = "db.sslmode"
-	SNSConfigSubject        = "sns.subject"
+	DBConfigHost              string = "db.host"
+	DBConfigUser                     = "db.user"
+	DBConfigPassword                 = "db.password"
+	DBConfigDBName                   = "db.dbname"
+	DBConfigSSLMode                  = "db.sslmode"
+	SNSConfigSubject                 = "sns.subject"
+	SNSConfigCompletedSubject        = "sns.completedSubject"
 )
@@ -14,10 +14,17 @@ import (
 )
 
 var Tables = []interface{}{
+	&table.Calendar{},
 	&table.Workflow{},
+	&table.WorkflowCalendar{},
+	&table.WorkflowDependency{},
+	&table.WorkflowLabel{},
+	&table.WorkflowVersion{},
+	&table.Backfill{},
 	&table.ScheduledWorkflow{},
 	&table.WorkflowSchedulerLock{},
 	&table.WorkflowActivatorLock{},
+	&table.SchedulerLeader{},
 }
 
 var owner = os.Getenv("OWNER_SNS")
@@ -27,7 +34,7 @@ var SampleWorkflows = []table.Workflow{
 		Name:        "1",
 		Artifact:    "", // empty string means local available
 		Command:     `["echo", "{\"name\": \"command1\"}"]`,
-		Every:       model.Every{1, model.EveryDay},
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
 		NextRuntime: time.Now().Add(-1 * time.Hour),
 		Backfill:    false,
 		Owner:       &owner,
@@ -37,7 +44,7 @@ var SampleWorkflows = []table.Workflow{
 		Name:        "2",
 		Artifact:    "",
 		Command:     `["echo", "{\"name\": \"command2\"}"]`,
-		Every:       model.Every{1, model.EveryDay},
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
 		NextRuntime: time.Now().Add(24 * time.Hour),
 		Backfill:    false,
 		Owner:       &owner,
@@ -47,7 +54,7 @@ var SampleWorkflows = []table.Workflow{
 		Name:        "3",
 		Artifact:    "",
 		Command:     `["echo", "{\"name\": \"command3\"}"]`,
-		Every:       model.Every{1, model.EveryDay},
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
 		NextRuntime: time.Now().Add(-24 * time.Hour),
 		Backfill:    true,
 		Owner:       &owner,
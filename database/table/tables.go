@@ -14,17 +14,43 @@ import (
 
 type Workflow struct {
 	gorm.Model
-	Name                 string      `gorm:"type:varchar(256);not null;index:workflows_name,unique"`
-	Artifact             string      `gorm:"type:varchar(2048);not null"`
-	Command              string      `gorm:"type:text;not null"`
-	Every                model.Every `gorm:"type:varchar(64);not null"`
-	NextRuntime          time.Time   `gorm:"not null"`
-	Backfill             bool        `gorm:"not null"`
-	Owner                *string     `gorm:"type:varchar(2048)"`
-	IsActive             bool        `gorm:"not null"`
-	ScheduleDelayMinutes uint        `gorm:"default:0"`
+	Name                     string              `gorm:"type:varchar(256);not null;index:workflows_name,unique"`
+	Artifact                 string              `gorm:"type:varchar(2048);not null"`
+	Command                  string              `gorm:"type:text;not null"`
+	Every                    model.Every         `gorm:"type:varchar(256);not null"`
+	NextRuntime              time.Time           `gorm:"not null"`
+	Backfill                 bool                `gorm:"not null"` // superseded by MisfirePolicy, kept for older rows
+	Owner                    *string             `gorm:"type:varchar(2048)"`
+	IsActive                 bool                `gorm:"not null"`
+	ScheduleDelayMinutes     uint                `gorm:"default:0"`
+	Timezone                 string              `gorm:"type:varchar(64);not null;default:UTC"`
+	ScheduleAnchor           *time.Time          // day or longer intervals keep its wall clock time of day
+	EndTime                  *time.Time          // no run is scheduled after this time
+	MaxRuns                  uint                `gorm:"default:0"` // 0 means no limit
+	RunCount                 uint                `gorm:"not null;default:0"`
+	MisfirePolicy            model.MisfirePolicy `gorm:"type:varchar(32)"` // empty derives it from Backfill
+	MisfireLastN             uint                `gorm:"default:0"`        // runs kept by fire_last_n
+	MaxCatchUpMinutes        uint                `gorm:"default:0"`        // 0 means no limit
+	OverlapPolicy            model.OverlapPolicy `gorm:"type:varchar(16);not null;default:allow"`
+	DependencyTimeoutMinutes uint                `gorm:"default:0"` // 0 means the scheduler default
+	Parameters               model.Parameters    `gorm:"type:text"`
+	TemplateCommand          bool                `gorm:"not null;default:false"` // command arguments are templates of the run
+	PausedAt                 *time.Time          // set while paused through the control service
+	PausedBy                 string              `gorm:"type:varchar(256)"`
+	PauseReason              string              `gorm:"type:text"`
+	ResumeAt                 *time.Time          // the scheduler resumes the paused workflow at this time
+	ResumedAt                *time.Time          // last resumed, PausedBy and PauseReason are kept for the last pause
+	ResumedBy                string              `gorm:"type:varchar(256)"`
+	ResumeReason             string              `gorm:"type:text"`
+	Version                  uint                `gorm:"not null;default:1"`      // bumped on every change of the definition
+	Team                     string              `gorm:"type:varchar(256);index"` // owning team
+	ClaimToken               string              `gorm:"type:varchar(64)"`        // scheduler holding the lease in the lease claim mode
+	ClaimExpiresAt           *time.Time          `gorm:"index"`                   // the lease is free past it
 
 	ScheduledWorkflows []ScheduledWorkflow
+	Labels             []WorkflowLabel
+	Calendars          []Calendar `gorm:"many2many:workflow_calendars"`
+	Upstreams          []Workflow `gorm:"many2many:workflow_dependencies;joinForeignKey:WorkflowID;joinReferences:UpstreamID"`
 }
 
 type ScheduledWorkflow struct {
@@ -34,6 +60,40 @@ type ScheduledWorkflow struct {
 	StartTime          time.Time `gorm:"not null"`
 	ScheduledStartTime time.Time `gorm:"not null"`
 	Status             string    `gorm:"type:varchar(64);not null"`
+	Reason             string    `gorm:"type:text"`
+	ActivatedAt        *time.Time
+	CompletedAt        *time.Time // when the run was seen over in orchard
+	SkippedUntil       *time.Time // last slot of the skipped slots summed up by the row, from ScheduledStartTime
+	DurationSeconds    int64      `gorm:"default:0"` // from activation to completion
+	TriggerType        string     `gorm:"type:varchar(16);not null;default:scheduled"`
+	BackfillID         *uint      `gorm:"index"`
+	RunID              string     `gorm:"type:varchar(64);index"` // shared by the orchard workflows generated for a slot
+	WorkflowVersion    uint       `gorm:"default:0"`              // definition version generated from, 0 if unknown
+	ClaimToken         string     `gorm:"type:varchar(64)"`       // scheduler holding the lease in the lease claim mode
+	ClaimExpiresAt     *time.Time `gorm:"index"`                  // the lease is free past it
+}
+
+// Backfill replays the slots of a workflow between FromTime (inclusive) and
+// ToTime (exclusive), with at most MaxParallelism runs in flight.
+type Backfill struct {
+	gorm.Model
+	WorkflowID     uint      `gorm:"not null"`
+	FromTime       time.Time `gorm:"not null"`
+	ToTime         time.Time `gorm:"not null"`
+	MaxParallelism uint      `gorm:"not null;default:1"`
+	CanceledAt     *time.Time
+	FailedAt       *time.Time // set when too many runs in a row couldn't be generated
+	FailureReason  string     `gorm:"type:text"`
+}
+
+// WorkflowVersion is a snapshot of a workflow definition, appended on every
+// change to it.
+type WorkflowVersion struct {
+	gorm.Model
+	WorkflowID uint   `gorm:"not null;uniqueIndex:workflow_versions_workflow_version"`
+	Version    uint   `gorm:"not null;uniqueIndex:workflow_versions_workflow_version"`
+	Action     string `gorm:"type:varchar(16);not null"` // put, patch, delete, rollback or restore
+	Definition string `gorm:"type:text;not null"`        // JSON, as accepted by the control service
 }
 
 type WorkflowSchedulerLock struct {
@@ -47,3 +107,41 @@ type WorkflowActivatorLock struct {
 	Token       string    `gorm:"type:varchar(64);not null"`
 	LockTime    time.Time `gorm:"not null"`
 }
+
+// SchedulerLeader is the lease of the scheduler replica running the singleton
+// duties, held by Holder until ExpiresAt unless renewed.
+type SchedulerLeader struct {
+	Name       string    `gorm:"type:varchar(64);primaryKey"`
+	Holder     string    `gorm:"type:varchar(256);not null"`
+	AcquiredAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+}
+
+// Calendar holds blackout windows that workflows referencing it are not
+// scheduled in.
+type Calendar struct {
+	gorm.Model
+	Name          string               `gorm:"type:varchar(256);not null;index:calendars_name,unique"`
+	Timezone      string               `gorm:"type:varchar(64);not null;default:UTC"`
+	Action        model.BlackoutAction `gorm:"type:varchar(16);not null;default:skip"`
+	DateRanges    model.DateRanges     `gorm:"type:text"`
+	WeeklyWindows model.WeeklyWindows  `gorm:"type:text"`
+}
+
+type WorkflowCalendar struct {
+	WorkflowID uint `gorm:"primaryKey"`
+	CalendarID uint `gorm:"primaryKey"`
+}
+
+// WorkflowLabel is a label of a workflow, stored as rows to select workflows
+// by label in SQL.
+type WorkflowLabel struct {
+	WorkflowID uint   `gorm:"primaryKey"`
+	Name       string `gorm:"type:varchar(317);primaryKey;index:workflow_labels_name_value"`
+	Value      string `gorm:"type:varchar(63);not null;index:workflow_labels_name_value"`
+}
+
+type WorkflowDependency struct {
+	WorkflowID uint `gorm:"primaryKey"`
+	UpstreamID uint `gorm:"primaryKey"`
+}
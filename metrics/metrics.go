@@ -58,6 +58,16 @@ func (m *histogramMetric) With(labels map[string]string) prometheus.Observer {
 	return m.histogram.With(unifyLabels(m.labels, labels))
 }
 
+type gaugeMetric struct {
+	key    string
+	gauge  *prometheus.GaugeVec
+	labels []string
+}
+
+func (m *gaugeMetric) With(labels map[string]string) prometheus.Gauge {
+	return m.gauge.With(unifyLabels(m.labels, labels))
+}
+
 type summaryMetric struct {
 	key     string
 	summary *prometheus.SummaryVec
@@ -73,6 +83,7 @@ var (
 	counters         = make(map[string]*counterMetric, 0)
 	histograms       = make(map[string]*histogramMetric, 0)
 	summaries        = make(map[string]*summaryMetric, 0)
+	gauges           = make(map[string]*gaugeMetric, 0)
 	defaultBuckets   = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 15.0, 60.0, 300.0, 1200.0, math.MaxFloat64}
 	defaultQuantiles = map[float64]float64{0.5: 0.001, 0.95: 0.001, 0.99: 0.001}
 )
@@ -101,6 +112,14 @@ func getSummary(name string) *summaryMetric {
 	return nil
 }
 
+func getGauge(name string) *gaugeMetric {
+	val, ok := gauges[name]
+	if ok {
+		return val
+	}
+	return nil
+}
+
 func unifyLabels(keyList []string, labels map[string]string) map[string]string {
 	finalMap := make(map[string]string)
 	for _, key := range keyList {
@@ -208,6 +227,34 @@ func AddSummary(key string, help string, labels []string) {
 	registry.MustRegister(newSummary.summary)
 }
 
+// AddGauge adds a new gauge metric
+// A new gauge metric is added with the name provided by key, and a description provided by help.
+// The labels provided should be any label that _could_ be associated with the gauge,
+// even if it's not _always_ associated with the gauge
+//
+// See the [gauge docs] for more information
+//
+// [gauge docs]: https://prometheus.io/docs/tutorials/understanding_metric_types/#gauge
+func AddGauge(key string, help string, labels []string) {
+	_, ok := gauges[key]
+	if ok {
+		return
+	}
+	newGauge := &gaugeMetric{
+		key:    key,
+		labels: labels,
+		gauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: key,
+				Help: help,
+			},
+			labels,
+		),
+	}
+	gauges[key] = newGauge
+	registry.MustRegister(newGauge.gauge)
+}
+
 // IncrementCounter will increment the counter specified by key by 1.
 // The labels provided by the labels property will be compared to the list of labels used to create the counter.
 // Any labels _not_ included in this call that were specified when the counter was created
@@ -237,6 +284,20 @@ func UpdateHistogram(key string, howLong time.Duration, labels map[string]string
 	histogram.With(labels).Observe(howLong.Seconds())
 }
 
+// SetGauge will set the gauge specified by key to value.
+// The labels provided by the labels property will be compared to the list of labels used to create the gauge.
+// Any labels _not_ included in this call that were specified when the gauge was created
+// will be given blank values (empty strings).
+// Any labels included in this call which were _not_ included when the gauge was created
+// will be silently ignored
+func SetGauge(key string, value float64, labels map[string]string) {
+	gauge := getGauge(key)
+	if gauge == nil {
+		return
+	}
+	gauge.With(labels).Set(value)
+}
+
 // UpdateSummary will update the summary specified by key with the duration from howLong as Seconds.
 // So a duration of 500ms will be recorded as 0.5 in the summary.
 // The labels provided by the labels property will be compared to the list of labels used to create the summary.
@@ -0,0 +1,177 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BlackoutAction is what happens to a run landing inside a calendar window.
+type BlackoutAction string
+
+const (
+	// the slot is not run and recorded as skipped
+	BlackoutSkip BlackoutAction = "skip"
+	// the slot waits until the window is over
+	BlackoutDefer BlackoutAction = "defer"
+)
+
+func ParseBlackoutAction(str string) (BlackoutAction, error) {
+	switch BlackoutAction(str) {
+	case "":
+		return BlackoutSkip, nil
+	case BlackoutSkip, BlackoutDefer:
+		return BlackoutAction(str), nil
+	}
+	return "", fmt.Errorf("Unsupported blackout action %q", str)
+}
+
+// DateRange is an absolute blackout period, [Start, End).
+type DateRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (r DateRange) Validate() error {
+	if !r.End.After(r.Start) {
+		return fmt.Errorf("date range end %s must be after start %s", r.End, r.Start)
+	}
+	return nil
+}
+
+// WeeklyWindow is a blackout recurring every week on the calendar wall clock,
+// e.g. {"day": "sat", "start": "22:00", "end": "04:00"}. An end not after the
+// start wraps into the following day, an end equal to the start makes a 24h
+// window.
+type WeeklyWindow struct {
+	Day   string `json:"day"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (w WeeklyWindow) Validate() error {
+	if _, ok := weekdays[strings.ToLower(w.Day)]; !ok {
+		return fmt.Errorf("weekly window day %q must be one of sun, mon, tue, wed, thu, fri, sat", w.Day)
+	}
+	if _, err := time.Parse("15:04", w.Start); err != nil {
+		return fmt.Errorf("weekly window start %q must be formatted as HH:MM", w.Start)
+	}
+	if _, err := time.Parse("15:04", w.End); err != nil {
+		return fmt.Errorf("weekly window end %q must be formatted as HH:MM", w.End)
+	}
+	return nil
+}
+
+// occurrence returns the window starting on the local date of day
+func (w WeeklyWindow) occurrence(day time.Time) (time.Time, time.Time, bool) {
+	if weekdays[strings.ToLower(w.Day)] != day.Weekday() {
+		return time.Time{}, time.Time{}, false
+	}
+	startClock, _ := time.Parse("15:04", w.Start)
+	endClock, _ := time.Parse("15:04", w.End)
+	y, m, d := day.Date()
+	start := WallClock(y, m, d, startClock.Hour(), startClock.Minute(), 0, 0, day.Location())
+	if !endClock.After(startClock) {
+		d++
+	}
+	end := WallClock(y, m, d, endClock.Hour(), endClock.Minute(), 0, 0, day.Location())
+	return start, end, true
+}
+
+type DateRanges []DateRange
+
+func (ranges *DateRanges) Scan(value any) error {
+	return scanJSON(value, ranges)
+}
+
+func (ranges DateRanges) Value() (driver.Value, error) {
+	return valueJSON(ranges)
+}
+
+type WeeklyWindows []WeeklyWindow
+
+func (windows *WeeklyWindows) Scan(value any) error {
+	return scanJSON(value, windows)
+}
+
+func (windows WeeklyWindows) Value() (driver.Value, error) {
+	return valueJSON(windows)
+}
+
+// back to back windows are merged up to this long past the time evaluated,
+// weekly windows covering the whole week would never end otherwise
+const maxBlackoutMerge = 8 * 24 * time.Hour
+
+// BlackoutUntil reports whether t falls inside one of the ranges or weekly
+// windows (evaluated in loc), and if so when that window ends. Back to back
+// windows are merged, until maxBlackoutMerge past t.
+func BlackoutUntil(t time.Time, loc *time.Location, ranges DateRanges, weekly WeeklyWindows) (time.Time, bool) {
+	until := t
+	for until.Sub(t) <= maxBlackoutMerge {
+		end, ok := blackoutEnd(until, loc, ranges, weekly)
+		if !ok {
+			break
+		}
+		until = end
+	}
+	return until, until.After(t)
+}
+
+func blackoutEnd(t time.Time, loc *time.Location, ranges DateRanges, weekly WeeklyWindows) (time.Time, bool) {
+	var end time.Time
+	for _, r := range ranges {
+		if !t.Before(r.Start) && t.Before(r.End) && r.End.After(end) {
+			end = r.End
+		}
+	}
+	local := t.In(loc)
+	// a window wrapping past midnight may have started the day before
+	for _, day := range []time.Time{local.AddDate(0, 0, -1), local} {
+		for _, w := range weekly {
+			start, wEnd, ok := w.occurrence(day)
+			if ok && !t.Before(start) && t.Before(wEnd) && wEnd.After(end) {
+				end = wEnd
+			}
+		}
+	}
+	return end, !end.IsZero()
+}
+
+func scanJSON(value any, dest any) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return errors.New(fmt.Sprintf("Invalid JSON value: %v", value))
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+func valueJSON(value any) (driver.Value, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
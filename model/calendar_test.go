@@ -0,0 +1,63 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlackoutUntil(t *testing.T) {
+	ranges := DateRanges{
+		{Start: time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	weekly := WeeklyWindows{
+		{Day: "sat", Start: "22:00", End: "04:00"},
+	}
+	for _, w := range weekly {
+		if err := w.Validate(); err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+	}
+
+	cases := []struct {
+		at       time.Time
+		expected time.Time
+		blocked  bool
+	}{
+		{time.Date(2024, 12, 25, 12, 0, 0, 0, time.UTC), time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), time.Time{}, false},
+		// saturday 2024-03-02 23:00, and the sunday morning of the same window
+		{time.Date(2024, 3, 2, 23, 0, 0, 0, time.UTC), time.Date(2024, 3, 3, 4, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 3, 3, 3, 59, 0, 0, time.UTC), time.Date(2024, 3, 3, 4, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 3, 3, 4, 0, 0, 0, time.UTC), time.Time{}, false},
+		{time.Date(2024, 3, 2, 21, 59, 0, 0, time.UTC), time.Time{}, false},
+	}
+	for _, c := range cases {
+		until, blocked := BlackoutUntil(c.at, time.UTC, ranges, weekly)
+		if blocked != c.blocked || (blocked && !until.Equal(c.expected)) {
+			t.Fatalf("at %v got (%v, %v), expected (%v, %v)", c.at, until, blocked, c.expected, c.blocked)
+		}
+	}
+
+	// windows covering the whole week are merged up to a bound
+	allWeek := WeeklyWindows{}
+	for day := range weekdays {
+		allWeek = append(allWeek, WeeklyWindow{Day: day, Start: "00:00", End: "00:00"})
+	}
+	at := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	until, blocked := BlackoutUntil(at, time.UTC, nil, allWeek)
+	if !blocked || until.Sub(at) <= maxBlackoutMerge || until.Sub(at) > maxBlackoutMerge+24*time.Hour {
+		t.Fatalf("at %v got (%v, %v), expected a bounded blackout", at, until, blocked)
+	}
+
+	if err := (WeeklyWindow{Day: "someday", Start: "22:00", End: "04:00"}).Validate(); err == nil {
+		t.Fatalf("should not succeed with an invalid day")
+	}
+	if err := (DateRange{Start: ranges[0].End, End: ranges[0].Start}).Validate(); err == nil {
+		t.Fatalf("should not succeed with an end before start")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression. Both the standard 5 field format
+// (minute hour day-of-month month day-of-week) and the 6 field format with a
+// leading seconds field are accepted, as well as the @yearly, @monthly,
+// @weekly, @daily and @hourly macros.
+type Cron struct {
+	expr string
+
+	second uint64
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// day-of-month and day-of-week are OR-ed together when both are
+	// restricted, following the vixie cron convention
+	domAny bool
+	dowAny bool
+}
+
+type cronField struct {
+	min   uint
+	max   uint
+	names map[string]uint
+}
+
+var (
+	cronSecond = cronField{0, 59, nil}
+	cronMinute = cronField{0, 59, nil}
+	cronHour   = cronField{0, 23, nil}
+	cronDom    = cronField{1, 31, nil}
+	cronMonth  = cronField{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted as an alias of sunday and folded into 0 after parsing
+	cronDow = cronField{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// how far ahead Next searches before giving up on an expression that can
+// never match (e.g. 30th of February), long enough to always contain a 29th
+// of February
+const cronSearchYears = 8
+
+func ParseCron(expr string) (Cron, error) {
+	normalized := strings.Join(strings.Fields(expr), " ")
+	spec := normalized
+	if strings.HasPrefix(spec, "@") {
+		macro, ok := cronMacros[strings.ToLower(spec)]
+		if !ok {
+			return Cron{}, fmt.Errorf("unsupported cron macro %q", spec)
+		}
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return Cron{}, fmt.Errorf("cron expression %q must have 5 or 6 fields", expr)
+	}
+
+	cron := Cron{expr: normalized}
+	var err error
+	if cron.second, err = parseCronField(fields[0], cronSecond); err != nil {
+		return Cron{}, err
+	}
+	if cron.minute, err = parseCronField(fields[1], cronMinute); err != nil {
+		return Cron{}, err
+	}
+	if cron.hour, err = parseCronField(fields[2], cronHour); err != nil {
+		return Cron{}, err
+	}
+	if cron.dom, err = parseCronField(fields[3], cronDom); err != nil {
+		return Cron{}, err
+	}
+	if cron.month, err = parseCronField(fields[4], cronMonth); err != nil {
+		return Cron{}, err
+	}
+	if cron.dow, err = parseCronField(fields[5], cronDow); err != nil {
+		return Cron{}, err
+	}
+	if cron.dow&(1<<7) != 0 {
+		cron.dow = (cron.dow &^ (1 << 7)) | 1
+	}
+	cron.domAny = isCronWildcard(fields[3])
+	cron.dowAny = isCronWildcard(fields[5])
+	if cron.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return Cron{}, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return cron, nil
+}
+
+func isCronWildcard(field string) bool {
+	return strings.HasPrefix(field, "*") || strings.HasPrefix(field, "?")
+}
+
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		bitsSet, err := parseCronPart(part, spec)
+		if err != nil {
+			return 0, err
+		}
+		set |= bitsSet
+	}
+	return set, nil
+}
+
+func parseCronPart(part string, spec cronField) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := uint(1)
+	if hasStep {
+		s, err := strconv.ParseUint(stepPart, 10, 8)
+		if err != nil || s == 0 {
+			return 0, fmt.Errorf("invalid cron step %q", part)
+		}
+		step = uint(s)
+	}
+
+	var lo, hi uint
+	switch {
+	case rangePart == "*" || rangePart == "?":
+		lo, hi = spec.min, spec.max
+	case strings.Contains(rangePart, "-"):
+		loStr, hiStr, _ := strings.Cut(rangePart, "-")
+		var err error
+		if lo, err = parseCronValue(loStr, spec); err != nil {
+			return 0, err
+		}
+		if hi, err = parseCronValue(hiStr, spec); err != nil {
+			return 0, err
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid cron range %q", part)
+		}
+	default:
+		v, err := parseCronValue(rangePart, spec)
+		if err != nil {
+			return 0, err
+		}
+		lo, hi = v, v
+		// "5/15" means starting at 5 through the end of the range
+		if hasStep {
+			hi = spec.max
+		}
+	}
+
+	var set uint64
+	for v := lo; v <= hi; v += step {
+		set |= 1 << v
+	}
+	return set, nil
+}
+
+func parseCronValue(value string, spec cronField) (uint, error) {
+	if n, ok := spec.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cron value %q", value)
+	}
+	if uint(n) < spec.min || uint(n) > spec.max {
+		return 0, fmt.Errorf("cron value %d out of range [%d, %d]", n, spec.min, spec.max)
+	}
+	return uint(n), nil
+}
+
+func (c Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first time strictly after t that matches the expression,
+// evaluated on the wall clock of t's location with the DST rules of
+// WallClock. A zero time is returned if nothing matches within the search
+// horizon.
+func (c Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	limit := day.AddDate(cronSearchYears, 0, 0)
+
+	for ; day.Before(limit); day = day.AddDate(0, 0, 1) {
+		if !c.matchesDay(day) {
+			continue
+		}
+		// wall clock order is only instant order when the day has no DST
+		// transition, otherwise every candidate has to be looked at
+		_, startOffset := day.Zone()
+		_, endOffset := day.AddDate(0, 0, 1).Add(-time.Nanosecond).Zone()
+		transition := startOffset != endOffset
+
+		var next time.Time
+		for _, h := range setBits(c.hour) {
+			for _, m := range setBits(c.minute) {
+				for _, s := range setBits(c.second) {
+					candidate := WallClock(day.Year(), day.Month(), day.Day(), int(h), int(m), int(s), 0, loc)
+					if !candidate.After(t) {
+						continue
+					}
+					if !transition {
+						return candidate
+					}
+					if next.IsZero() || candidate.Before(next) {
+						next = candidate
+					}
+				}
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func (c Cron) matchesDay(day time.Time) bool {
+	if c.month&(1<<uint(day.Month())) == 0 {
+		return false
+	}
+	domMatch := c.dom&(1<<uint(day.Day())) != 0
+	dowMatch := c.dow&(1<<uint(day.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func setBits(set uint64) []uint {
+	values := make([]uint, 0, bits.OnesCount64(set))
+	for set != 0 {
+		v := uint(bits.TrailingZeros64(set))
+		values = append(values, v)
+		set &^= 1 << v
+	}
+	return values
+}
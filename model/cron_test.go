@@ -0,0 +1,123 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	valid := []string{
+		"30 9 * * MON-FRI",
+		"0 30 9 * * 1-5",
+		"0 0 1,15 * *",
+		"*/15 * * * *",
+		"0 12 ? JAN,JUL SUN",
+		"@daily",
+		"@hourly",
+	}
+	for _, str := range valid {
+		if _, err := ParseCron(str); err != nil {
+			t.Fatalf("got error: %v with input %q", err, str)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"0 0 30 2 *",
+		"@fortnightly",
+	}
+	for _, str := range invalid {
+		if _, err := ParseCron(str); err == nil {
+			t.Fatalf("should not succeed with input: %q", str)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	cases := []struct {
+		expr     string
+		from     time.Time
+		expected time.Time
+	}{
+		{
+			// weekdays at 09:30, friday evening rolls over to monday
+			"30 9 * * MON-FRI",
+			time.Date(2024, 3, 8, 18, 0, 0, 0, time.UTC),
+			time.Date(2024, 3, 11, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			// strictly after the current match
+			"30 9 * * MON-FRI",
+			time.Date(2024, 3, 11, 9, 30, 0, 0, time.UTC),
+			time.Date(2024, 3, 12, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			"0 0 1,15 * *",
+			time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"15 */20 * * * *",
+			time.Date(2024, 1, 1, 10, 59, 30, 0, time.UTC),
+			time.Date(2024, 1, 1, 11, 0, 15, 0, time.UTC),
+		},
+		{
+			"@daily",
+			time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+			time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// both day fields restricted: either one matching is enough
+			"0 0 13 * 5",
+			time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"0 0 29 2 *",
+			time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("got error: %v with input %q", err, c.expr)
+		}
+		if next := cron.Next(c.from); !next.Equal(c.expected) {
+			t.Fatalf("%q next of %v is %v, expected %v", c.expr, c.from, next, c.expected)
+		}
+	}
+}
+
+func TestEveryCron(t *testing.T) {
+	str := "30 9 * * MON-FRI"
+
+	every, err := ParseEvery(str)
+	if err != nil {
+		t.Fatalf("got error: %v with input %q", err, str)
+	}
+	if !every.IsCron() {
+		t.Fatalf("should be a cron schedule with input: %q", str)
+	}
+	if every.String() != str {
+		t.Fatalf("%q doesn't round trip, got %q", str, every.String())
+	}
+
+	var scanned Every
+	if err := scanned.Scan("1.day"); err != nil {
+		t.Fatalf("got error: %v scanning %q", err, "1.day")
+	}
+	if scanned.IsCron() || scanned.String() != "1.day" {
+		t.Fatalf("%q doesn't round trip, got %q", "1.day", scanned.String())
+	}
+}
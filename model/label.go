@@ -0,0 +1,55 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// label names and values follow the Kubernetes syntax, names may have a DNS
+// subdomain prefix
+var (
+	labelValue  = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9_.-]{0,61}[A-Za-z0-9])?)?$`)
+	labelPrefix = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]{0,251}[a-z0-9])?$`)
+)
+
+// Labels are free-form key/value pairs used to select workflows.
+type Labels map[string]string
+
+func ValidateLabelKey(key string) error {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		if !labelPrefix.MatchString(key[:i]) {
+			return fmt.Errorf("Invalid label key prefix %q", key)
+		}
+		name = key[i+1:]
+	}
+	if name == "" || !labelValue.MatchString(name) {
+		return fmt.Errorf("Invalid label key %q", key)
+	}
+	return nil
+}
+
+func ValidateLabelValue(value string) error {
+	if !labelValue.MatchString(value) {
+		return fmt.Errorf("Invalid label value %q", value)
+	}
+	return nil
+}
+
+func (labels Labels) Validate() error {
+	for key, value := range labels {
+		if err := ValidateLabelKey(key); err != nil {
+			return err
+		}
+		if err := ValidateLabelValue(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import "fmt"
+
+// MisfirePolicy is what the scheduler does with slots it missed, e.g. after
+// an outage.
+type MisfirePolicy string
+
+const (
+	// run every missed slot, oldest first, one per scheduler tick
+	MisfireFireAll MisfirePolicy = "fire_all"
+	// run a single catch-up for the most recent missed slot
+	MisfireFireOnceNow MisfirePolicy = "fire_once_now"
+	// run none of the missed slots
+	MisfireSkip MisfirePolicy = "skip"
+	// run the N most recent missed slots
+	MisfireFireLastN MisfirePolicy = "fire_last_n"
+)
+
+func ParseMisfirePolicy(str string) (MisfirePolicy, error) {
+	switch MisfirePolicy(str) {
+	case MisfireFireAll, MisfireFireOnceNow, MisfireSkip, MisfireFireLastN:
+		return MisfirePolicy(str), nil
+	}
+	return "", fmt.Errorf("Unsupported misfire policy %q", str)
+}
+
+// MisfirePolicyOf maps the legacy backfill flag of workflows created before
+// misfire policies existed.
+func MisfirePolicyOf(policy MisfirePolicy, backfill bool) MisfirePolicy {
+	if policy != "" {
+		return policy
+	}
+	if backfill {
+		return MisfireFireAll
+	}
+	return MisfireFireOnceNow
+}
@@ -13,9 +13,12 @@ import (
 	"strconv"
 )
 
+// Every is either a fixed interval (Quantity and Unit, e.g. "1.day") or, when
+// Cron is set, a cron expression (e.g. "30 9 * * MON-FRI").
 type Every struct {
 	Quantity uint
 	Unit     EveryUnit
+	Cron     *Cron
 }
 
 type EveryUnit string
@@ -54,21 +57,32 @@ func (every Every) Value() (driver.Value, error) {
 }
 
 func (every Every) String() string {
+	if every.Cron != nil {
+		return every.Cron.String()
+	}
 	return fmt.Sprintf("%d.%s", every.Quantity, every.Unit)
 }
 
+func (every Every) IsCron() bool {
+	return every.Cron != nil
+}
+
 func ParseEvery(str string) (Every, error) {
 	re := regexp.MustCompile("^([0-9]+)\\.(minute|hour|day|week|month|year)$")
 	matches := re.FindStringSubmatch(str)
 
 	if len(matches) != 3 {
-		return Every{}, errors.New("Invalid every string format")
+		cron, err := ParseCron(str)
+		if err != nil {
+			return Every{}, fmt.Errorf("Invalid every string format: %w", err)
+		}
+		return Every{Cron: &cron}, nil
 	}
 	// it should not fail, regex should handle that already
 	c, _ := strconv.Atoi(matches[1])
 
 	if u, ok := EveryUnits[EveryUnit(matches[2])]; ok {
-		return Every{uint(c), u}, nil
+		return Every{Quantity: uint(c), Unit: u}, nil
 	}
 
 	return Every{}, errors.New("Unsupported every unit")
@@ -0,0 +1,33 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import "fmt"
+
+// OverlapPolicy is what the scheduler does when a slot is due while the
+// previous run of the workflow is still in progress.
+type OverlapPolicy string
+
+const (
+	// runs may overlap
+	OverlapAllow OverlapPolicy = "allow"
+	// the slot is not run and recorded as skipped
+	OverlapForbid OverlapPolicy = "forbid"
+	// the slot waits until the previous run is over
+	OverlapQueue OverlapPolicy = "queue"
+	// the previous run is canceled
+	OverlapReplace OverlapPolicy = "replace"
+)
+
+func ParseOverlapPolicy(str string) (OverlapPolicy, error) {
+	switch OverlapPolicy(str) {
+	case "":
+		return OverlapAllow, nil
+	case OverlapAllow, OverlapForbid, OverlapQueue, OverlapReplace:
+		return OverlapPolicy(str), nil
+	}
+	return "", fmt.Errorf("Unsupported overlap policy %q", str)
+}
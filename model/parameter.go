@@ -0,0 +1,124 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ParameterType tells how a workflow parameter value is exposed.
+type ParameterType string
+
+const (
+	// the value is returned and logged as is
+	ParameterString ParameterType = "string"
+	// the value is only given to the generator
+	ParameterSecret ParameterType = "secret"
+)
+
+// RedactedValue replaces secret parameter values outside of the generator
+const RedactedValue = "******"
+
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func ParseParameterType(str string) (ParameterType, error) {
+	switch ParameterType(str) {
+	case "":
+		return ParameterString, nil
+	case ParameterString, ParameterSecret:
+		return ParameterType(str), nil
+	}
+	return "", fmt.Errorf("Unsupported parameter type %q", str)
+}
+
+type Parameter struct {
+	Value string        `json:"value"`
+	Type  ParameterType `json:"type,omitempty"`
+}
+
+// Parameters are the workflow parameters by name, names are usable as
+// environment variable names and template fields.
+type Parameters map[string]Parameter
+
+func (params *Parameters) Scan(value any) error {
+	return scanJSON(value, params)
+}
+
+func (params Parameters) Value() (driver.Value, error) {
+	return valueJSON(params)
+}
+
+// Validate checks the names and types, defaulting the types to string
+func (params Parameters) Validate() error {
+	for name, param := range params {
+		if !parameterName.MatchString(name) {
+			return fmt.Errorf("Invalid parameter name %q", name)
+		}
+		if strings.HasPrefix(strings.ToUpper(name), "SPRINKLER_") {
+			return fmt.Errorf("Parameter name %q uses the reserved SPRINKLER_ prefix", name)
+		}
+		paramType, err := ParseParameterType(string(param.Type))
+		if err != nil {
+			return err
+		}
+		param.Type = paramType
+		params[name] = param
+	}
+	return nil
+}
+
+// Redacted is a copy of params with the secret values replaced
+func (params Parameters) Redacted() Parameters {
+	if params == nil {
+		return nil
+	}
+	redacted := make(Parameters, len(params))
+	for name, param := range params {
+		if param.Type == ParameterSecret {
+			param.Value = RedactedValue
+		}
+		redacted[name] = param
+	}
+	return redacted
+}
+
+// Values are the parameter values by name
+func (params Parameters) Values() map[string]string {
+	values := make(map[string]string, len(params))
+	for name, param := range params {
+		values[name] = param.Value
+	}
+	return values
+}
+
+// Redact replaces the secret values found in str
+func (params Parameters) Redact(str string) string {
+	for _, param := range params {
+		if param.Type == ParameterSecret && param.Value != "" {
+			str = strings.ReplaceAll(str, param.Value, RedactedValue)
+		}
+	}
+	return str
+}
+
+// String keeps secret values out of logs
+func (params Parameters) String() string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	redacted := params.Redacted()
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, redacted[name].Value))
+	}
+	return fmt.Sprintf("map[%s]", strings.Join(pairs, " "))
+}
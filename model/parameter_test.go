@@ -0,0 +1,51 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParameters(t *testing.T) {
+	params := Parameters{
+		"tenant": {Value: "acme"},
+		"token":  {Value: "s3cr3t", Type: ParameterSecret},
+	}
+	if err := params.Validate(); err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	if params["tenant"].Type != ParameterString {
+		t.Fatalf("type %q should default to %q", params["tenant"].Type, ParameterString)
+	}
+
+	redacted := params.Redacted()
+	if redacted["token"].Value != RedactedValue || redacted["tenant"].Value != "acme" {
+		t.Fatalf("unexpected redacted parameters %v", redacted)
+	}
+	if params["token"].Value != "s3cr3t" {
+		t.Fatalf("Redacted should not modify the parameters")
+	}
+	if str := fmt.Sprintf("%v", params); strings.Contains(str, "s3cr3t") {
+		t.Fatalf("secret logged in %s", str)
+	}
+	if str := params.Redact("token=s3cr3t"); str != "token="+RedactedValue {
+		t.Fatalf("secret not redacted from %s", str)
+	}
+
+	invalid := []Parameters{
+		{"1tenant": {Value: "acme"}},
+		{"ten-ant": {Value: "acme"}},
+		{"SPRINKLER_RUN_ID": {Value: "run"}},
+		{"tenant": {Value: "acme", Type: "number"}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("%v should be invalid", p)
+		}
+	}
+}
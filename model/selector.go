@@ -0,0 +1,112 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SelectorOperator is how a selector requirement matches a label.
+type SelectorOperator string
+
+const (
+	SelectorEquals       SelectorOperator = "="
+	SelectorNotEquals    SelectorOperator = "!="
+	SelectorIn           SelectorOperator = "in"
+	SelectorNotIn        SelectorOperator = "notin"
+	SelectorExists       SelectorOperator = "exists"
+	SelectorDoesNotExist SelectorOperator = "!"
+)
+
+// Requirement is a single term of a label selector. Negative operators match
+// workflows without the label too.
+type Requirement struct {
+	Key      string
+	Operator SelectorOperator
+	Values   []string
+}
+
+// Selector is a Kubernetes style label selector, all of its requirements
+// must match.
+type Selector []Requirement
+
+var setRequirement = regexp.MustCompile(`^(\S+)\s+(in|notin)\s+\((.*)\)$`)
+
+// ParseSelector parses comma separated requirements: key=value, key==value,
+// key!=value, key in (v1,v2), key notin (v1,v2), key and !key
+func ParseSelector(str string) (Selector, error) {
+	selector := Selector{}
+	for _, term := range splitSelector(str) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("Empty requirement in selector %q", str)
+		}
+		requirement, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateLabelKey(requirement.Key); err != nil {
+			return nil, err
+		}
+		for _, value := range requirement.Values {
+			if err := ValidateLabelValue(value); err != nil {
+				return nil, err
+			}
+		}
+		selector = append(selector, requirement)
+	}
+	return selector, nil
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	if match := setRequirement.FindStringSubmatch(term); match != nil {
+		values := []string{}
+		for _, value := range strings.Split(match[3], ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+		return Requirement{Key: match[1], Operator: SelectorOperator(match[2]), Values: values}, nil
+	}
+	if strings.HasPrefix(term, "!") {
+		return Requirement{Key: strings.TrimSpace(term[1:]), Operator: SelectorDoesNotExist}, nil
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(term, op); i >= 0 {
+			operator := SelectorEquals
+			if op == "!=" {
+				operator = SelectorNotEquals
+			}
+			key := strings.TrimSpace(term[:i])
+			value := strings.TrimSpace(term[i+len(op):])
+			return Requirement{Key: key, Operator: operator, Values: []string{value}}, nil
+		}
+	}
+	if strings.ContainsAny(term, " ()") {
+		return Requirement{}, fmt.Errorf("Invalid selector requirement %q", term)
+	}
+	return Requirement{Key: term, Operator: SelectorExists}, nil
+}
+
+// splitSelector splits str on the commas outside of parentheses
+func splitSelector(str string) []string {
+	terms := []string{}
+	depth, start := 0, 0
+	for i, r := range str {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, str[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, str[start:])
+}
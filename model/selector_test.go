@@ -0,0 +1,56 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector("env=prod, tier!=batch,region in (us, eu),team notin (a),example.com/owned,!legacy,app==web")
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	expected := Selector{
+		{Key: "env", Operator: SelectorEquals, Values: []string{"prod"}},
+		{Key: "tier", Operator: SelectorNotEquals, Values: []string{"batch"}},
+		{Key: "region", Operator: SelectorIn, Values: []string{"us", "eu"}},
+		{Key: "team", Operator: SelectorNotIn, Values: []string{"a"}},
+		{Key: "example.com/owned", Operator: SelectorExists},
+		{Key: "legacy", Operator: SelectorDoesNotExist},
+		{Key: "app", Operator: SelectorEquals, Values: []string{"web"}},
+	}
+	if !reflect.DeepEqual(selector, expected) {
+		t.Fatalf("parsed %v doesn't match %v", selector, expected)
+	}
+
+	invalid := []string{
+		"",
+		"env=prod,",
+		"env=pr od",
+		"region in (us",
+		"bad key=prod",
+		"env=prod;drop",
+		"-env=prod",
+	}
+	for _, str := range invalid {
+		if _, err := ParseSelector(str); err == nil {
+			t.Fatalf("%q should be invalid", str)
+		}
+	}
+}
+
+func TestLabelsValidate(t *testing.T) {
+	if err := (Labels{"env": "prod", "example.com/tier": "", "app.kubernetes.io_name": "web-1"}).Validate(); err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	for _, labels := range []Labels{{"": "prod"}, {"env": "-prod"}, {"Example.com/env": "prod"}, {"env": "a b"}} {
+		if err := labels.Validate(); err == nil {
+			t.Fatalf("%v should be invalid", labels)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	// embed the IANA database so time zones resolve on hosts without tzdata
+	_ "time/tzdata"
+)
+
+const DefaultTimezone = "UTC"
+
+// LoadTimezone resolves an IANA time zone name, an empty name means UTC.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// WallClock returns the instant of the given wall clock time in loc, unlike
+// time.Date the DST transitions are resolved deterministically:
+//   - a nonexistent time (skipped by a spring forward) is shifted forward by
+//     the length of the gap, e.g. 02:30 becomes 03:30
+//   - an ambiguous time (repeated by a fall back) resolves to its first
+//     occurrence, so it runs once
+func WallClock(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) time.Time {
+	naive := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+
+	// DST transitions are never closer than a day apart, so the offsets half a
+	// day around the wall clock are the only two candidates
+	_, before := naive.Add(-12 * time.Hour).In(loc).Zone()
+	_, after := naive.Add(12 * time.Hour).In(loc).Zone()
+
+	var resolved time.Time
+	for _, offset := range []int{before, after} {
+		candidate := naive.Add(-time.Duration(offset) * time.Second).In(loc)
+		if !sameWallClock(candidate, naive) {
+			continue
+		}
+		if resolved.IsZero() || candidate.Before(resolved) {
+			resolved = candidate
+		}
+	}
+	if !resolved.IsZero() {
+		return resolved
+	}
+	// inside a gap, the offset in effect before the transition lands the
+	// same distance past the end of the gap
+	return naive.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+func sameWallClock(t time.Time, naive time.Time) bool {
+	y, m, d := t.Date()
+	ny, nm, nd := naive.Date()
+	return y == ny && m == nm && d == nd &&
+		t.Hour() == naive.Hour() && t.Minute() == naive.Minute() && t.Second() == naive.Second()
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWallClock(t *testing.T) {
+	loc, err := LoadTimezone("America/New_York")
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	// regular time
+	got := WallClock(2024, 6, 1, 9, 30, 0, 0, loc)
+	if expected := time.Date(2024, 6, 1, 13, 30, 0, 0, time.UTC); !got.Equal(expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+
+	// 02:30 doesn't exist on spring forward, shifted to 03:30 EDT
+	got = WallClock(2024, 3, 10, 2, 30, 0, 0, loc)
+	if expected := time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC); !got.Equal(expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+
+	// 01:30 happens twice on fall back, first occurrence is EDT
+	got = WallClock(2024, 11, 3, 1, 30, 0, 0, loc)
+	if expected := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC); !got.Equal(expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+
+	if _, err := LoadTimezone("Mars/Olympus_Mons"); err == nil {
+		t.Fatalf("should not succeed with an unknown timezone")
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc, _ := LoadTimezone("America/New_York")
+
+	cron, _ := ParseCron("30 2 * * *")
+	next := cron.Next(time.Date(2024, 3, 9, 2, 30, 0, 0, loc))
+	if expected := time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Fatalf("got %v, expected %v", next, expected)
+	}
+	next = cron.Next(next)
+	if expected := time.Date(2024, 3, 11, 6, 30, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Fatalf("got %v, expected %v", next, expected)
+	}
+
+	// the repeated hour only runs once
+	cron, _ = ParseCron("0 * * * *")
+	next = cron.Next(time.Date(2024, 11, 3, 5, 0, 0, 0, time.UTC).In(loc))
+	if expected := time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Fatalf("got %v, expected %v", next, expected)
+	}
+}
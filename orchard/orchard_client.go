@@ -7,7 +7,9 @@ package orchard
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -18,6 +20,8 @@ import (
 	"mce.salesforce.com/sprinkler/database/table"
 )
 
+var ErrNotFound = errors.New("not found")
+
 type OrchardClient interface {
 	Create(*table.Workflow) (string, error)
 	Activate(string) error
@@ -48,9 +52,9 @@ func (c OrchardRestClient) request(method string, url string, body io.Reader) (*
 	return rsp, nil
 }
 
-func (c OrchardRestClient) Create(wf table.Workflow) ([]string, error) {
+func (c OrchardRestClient) Create(ctx context.Context, wf table.Workflow, rc RunContext) ([]string, error) {
 	runner := OrchardStdoutRunner{}
-	results, err := runner.Generate(wf.Artifact, wf.Command)
+	results, err := runner.Generate(ctx, wf.Artifact, wf.Command, rc)
 	if err != nil {
 		log.Printf("OrchardRestClient Create > Generate error: %v\n", err)
 		return []string{}, err
@@ -89,12 +93,12 @@ func (c OrchardRestClient) create(result string) (string, error) {
 func (c OrchardRestClient) Details(orchardID string) (*Details, error) {
 	url := fmt.Sprintf("%s/v1/workflow/%s/details", c.Host, orchardID)
 	rsp, err := c.request(http.MethodGet, url, nil)
+	if rsp != nil && rsp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("workflow %s is %w", orchardID, ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if rsp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("workflow %s is not found", orchardID)
-	}
 	defer rsp.Body.Close()
 	body, err := io.ReadAll(rsp.Body)
 	if err != nil {
@@ -131,9 +135,9 @@ func (c OrchardRestClient) Delete(orchardID string) error {
 type FakeOrchardClient struct {
 }
 
-func (c FakeOrchardClient) Create(wf table.Workflow) ([]string, error) {
+func (c FakeOrchardClient) Create(ctx context.Context, wf table.Workflow, rc RunContext) ([]string, error) {
 	runner := OrchardStdoutRunner{}
-	results, err := runner.Generate(wf.Artifact, wf.Command)
+	results, err := runner.Generate(ctx, wf.Artifact, wf.Command, rc)
 	if err != nil {
 		return []string{""}, err
 	}
@@ -0,0 +1,93 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package orchard
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"mce.salesforce.com/sprinkler/model"
+)
+
+// RunContext is the run of a workflow the generator is invoked for
+type RunContext struct {
+	WorkflowName       string
+	ScheduledStartTime time.Time
+	RunID              string
+	TriggerType        string
+	Parameters         model.Parameters
+	// the command arguments are templates of the run, the commands saved
+	// before templating was introduced are run as they are
+	TemplateCommand bool
+}
+
+var commandFuncs = template.FuncMap{
+	// {{.ScheduledStartTime | date "2006-01-02"}}
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+func (rc RunContext) templateData() map[string]interface{} {
+	return map[string]interface{}{
+		"WorkflowName":       rc.WorkflowName,
+		"ScheduledStartTime": rc.ScheduledStartTime,
+		"RunID":              rc.RunID,
+		"TriggerType":        rc.TriggerType,
+		"Params":             rc.Parameters.Values(),
+	}
+}
+
+// ParameterEnvPrefix namespaces the workflow parameters in the generator
+// environment, so they can't override the variables it inherits (PATH,
+// LD_PRELOAD, ...)
+const ParameterEnvPrefix = "SPRINKLER_PARAM_"
+
+// environ is the generator process environment on top of the sprinkler one
+func (rc RunContext) environ() []string {
+	env := []string{
+		"SPRINKLER_WORKFLOW_NAME=" + rc.WorkflowName,
+		"SPRINKLER_SCHEDULED_START_TIME=" + rc.ScheduledStartTime.Format(time.RFC3339),
+		"SPRINKLER_RUN_ID=" + rc.RunID,
+		"SPRINKLER_TRIGGER_TYPE=" + rc.TriggerType,
+	}
+	for name, param := range rc.Parameters {
+		env = append(env, ParameterEnvPrefix+name+"="+param.Value)
+	}
+	return env
+}
+
+// renderCommand executes every argument of the command line as a template
+// of rc
+func renderCommand(cmds []string, rc RunContext) ([]string, error) {
+	data := rc.templateData()
+	rendered := make([]string, 0, len(cmds))
+	for _, arg := range cmds {
+		tmpl, err := template.New("command").Funcs(commandFuncs).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return []string{}, fmt.Errorf("invalid command template %q: %w", arg, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return []string{}, fmt.Errorf("invalid command template %q: %w", arg, err)
+		}
+		rendered = append(rendered, buf.String())
+	}
+	return rendered, nil
+}
+
+// ValidateCommand checks the templates of a JSON array command line against
+// the workflow parameters, other commands are left for the generator to reject
+func ValidateCommand(command string, params model.Parameters) error {
+	cmds, err := parseCommandLine(command)
+	if err != nil {
+		return nil
+	}
+	_, err = renderCommand(cmds, RunContext{ScheduledStartTime: time.Now(), Parameters: params})
+	return err
+}
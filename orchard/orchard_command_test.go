@@ -0,0 +1,127 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package orchard
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mce.salesforce.com/sprinkler/model"
+)
+
+func TestRenderCommand(t *testing.T) {
+	rc := RunContext{
+		WorkflowName:       "test.workflow",
+		ScheduledStartTime: time.Date(2024, 5, 1, 6, 30, 0, 0, time.UTC),
+		RunID:              "run-1",
+		TriggerType:        "manual",
+		Parameters:         model.Parameters{"tenant": {Value: "acme"}},
+	}
+	cmds, err := renderCommand([]string{
+		"generate",
+		"--date={{.ScheduledStartTime | date \"2006-01-02\"}}",
+		"{{.WorkflowName}}/{{.RunID}}/{{.TriggerType}}",
+		"--tenant={{.Params.tenant}}",
+	}, rc)
+	if err != nil {
+		t.Fatalf("unable to render command: %v", err)
+	}
+	expected := []string{"generate", "--date=2024-05-01", "test.workflow/run-1/manual", "--tenant=acme"}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("rendered %v doesn't match %v", cmds, expected)
+	}
+
+	for _, arg := range []string{"{{.Unknown}}", "{{.Params.region}}"} {
+		if _, err := renderCommand([]string{arg}, rc); err == nil {
+			t.Fatalf("unknown template variable %s should fail", arg)
+		}
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	valid := []string{
+		`["java", "-jar", "test.jar", "{{.ScheduledStartTime | date \"2006-01-02\"}}"]`,
+		`["java", "-jar", "test.jar", "{{.Params.tenant}}"]`,
+		"java -jar test.jar",
+	}
+	params := model.Parameters{"tenant": {Value: "acme"}}
+	for _, command := range valid {
+		if err := ValidateCommand(command, params); err != nil {
+			t.Fatalf("%s should be valid: %v", command, err)
+		}
+	}
+	invalid := []string{
+		`["java", "{{.ScheduledStartTime | date}}"]`,
+		`["java", "{{.RunID"]`,
+		`["java", "{{.Unknown}}"]`,
+		`["java", "{{.Params.region}}"]`,
+	}
+	for _, command := range invalid {
+		if err := ValidateCommand(command, params); err == nil {
+			t.Fatalf("%s should be invalid", command)
+		}
+	}
+}
+
+func TestProcessCmdRunContext(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unable to get the working directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	rc := RunContext{
+		WorkflowName:       "test.workflow",
+		ScheduledStartTime: time.Date(2024, 5, 1, 6, 30, 0, 0, time.UTC),
+		RunID:              "run-1",
+		TriggerType:        "scheduled",
+		Parameters: model.Parameters{
+			"TENANT": {Value: "acme"},
+			"TOKEN":  {Value: "s3cr3t", Type: model.ParameterSecret},
+		},
+		TemplateCommand: true,
+	}
+	command := `["sh", "-c", "echo $SPRINKLER_WORKFLOW_NAME $SPRINKLER_SCHEDULED_START_TIME $SPRINKLER_RUN_ID $SPRINKLER_TRIGGER_TYPE {{.ScheduledStartTime | date \"20060102\"}} $SPRINKLER_PARAM_TENANT"]`
+	outputs, err := processCmd(context.Background(), command, t.TempDir(), rc)
+	if err != nil {
+		t.Fatalf("unable to process command: %v", err)
+	}
+	expected := []string{"test.workflow 2024-05-01T06:30:00Z run-1 scheduled 20240501 acme"}
+	if !reflect.DeepEqual(outputs, expected) {
+		t.Fatalf("outputs %v don't match %v", outputs, expected)
+	}
+
+	// commands not flagged as templates are run as they are
+	legacy := rc
+	legacy.TemplateCommand = false
+	outputs, err = processCmd(context.Background(), `["echo", "{{.RunID}}"]`, t.TempDir(), legacy)
+	if err != nil {
+		t.Fatalf("unable to process command: %v", err)
+	}
+	if expected := []string{"{{.RunID}}"}; !reflect.DeepEqual(outputs, expected) {
+		t.Fatalf("outputs %v don't match %v", outputs, expected)
+	}
+
+	// parameters don't override the inherited environment
+	home := rc
+	home.Parameters = model.Parameters{"HOME": {Value: "/nowhere"}}
+	outputs, err = processCmd(context.Background(), `["sh", "-c", "echo $HOME $SPRINKLER_PARAM_HOME"]`, t.TempDir(), home)
+	if err != nil {
+		t.Fatalf("unable to process command: %v", err)
+	}
+	if expected := []string{os.Getenv("HOME") + " /nowhere"}; !reflect.DeepEqual(outputs, expected) {
+		t.Fatalf("outputs %v don't match %v", outputs, expected)
+	}
+
+	_, err = processCmd(context.Background(), `["sh", "-c", "echo $SPRINKLER_PARAM_TOKEN; exit 1"]`, t.TempDir(), rc)
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") || !strings.Contains(err.Error(), model.RedactedValue) {
+		t.Fatalf("secret should be redacted from %v", err)
+	}
+}
@@ -25,3 +25,16 @@ func ParseDetails(resp []byte) (*Details, error) {
 	}
 	return &data, nil
 }
+
+// IsTerminal reports whether the orchard workflow is over
+func (d Details) IsTerminal() bool {
+	switch d.Status {
+	case "finished", "failed", "canceled", "timeout", "deleted":
+		return true
+	}
+	return false
+}
+
+func (d Details) IsSucceeded() bool {
+	return d.Status == "finished"
+}
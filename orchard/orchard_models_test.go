@@ -34,3 +34,18 @@ func TestDetails(t *testing.T) {
 		t.Fatalf("parsed %s doesn't match %s", details.CreatedAt, wfCreatedAt)
 	}
 }
+
+func TestDetailsIsTerminal(t *testing.T) {
+	for status, terminal := range map[string]bool{
+		"pending":   false,
+		"activated": false,
+		"running":   false,
+		"finished":  true,
+		"failed":    true,
+		"canceled":  true,
+	} {
+		if (Details{Status: status}).IsTerminal() != terminal {
+			t.Fatalf("status %s should have IsTerminal %v", status, terminal)
+		}
+	}
+}
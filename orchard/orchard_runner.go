@@ -7,6 +7,7 @@ package orchard
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,24 +22,25 @@ import (
 const baseDir string = "/sprinkler"
 
 type OrchardRunner interface {
-	Generate(artifact string, command string) (string, error)
+	Generate(ctx context.Context, artifact string, command string, rc RunContext) (string, error)
 }
 
 type OrchardStdoutRunner struct{}
 
-func (r OrchardStdoutRunner) Generate(artifact string, command string) ([]string, error) {
+// Generate runs the generator command, which is killed once ctx is done
+func (r OrchardStdoutRunner) Generate(ctx context.Context, artifact string, command string, rc RunContext) ([]string, error) {
 	if artifact == "" {
-		return processCmd(command, baseDir)
+		return processCmd(ctx, command, baseDir, rc)
 	}
 
 	if !strings.HasPrefix(artifact, "s3://") {
 		return []string{}, fmt.Errorf("artifact %v is not supported\n", artifact)
 	}
 
-	return s3ArtifactGenerate(artifact, command)
+	return s3ArtifactGenerate(ctx, artifact, command, rc)
 }
 
-func s3ArtifactGenerate(artifact string, command string) ([]string, error) {
+func s3ArtifactGenerate(ctx context.Context, artifact string, command string, rc RunContext) ([]string, error) {
 
 	// tmp directory to avoid threads race on downloaded artifact
 	tmpDir, err := os.MkdirTemp("", "sprinkler-")
@@ -76,7 +78,7 @@ func s3ArtifactGenerate(artifact string, command string) ([]string, error) {
 		}
 	}(tmpDir)
 
-	return processCmd(command, tmpDir)
+	return processCmd(ctx, command, tmpDir, rc)
 }
 
 func cmdOutput(cmd *exec.Cmd) ([]byte, []byte, error) {
@@ -94,7 +96,7 @@ func cmdOutput(cmd *exec.Cmd) ([]byte, []byte, error) {
 	return b.Bytes(), c.Bytes(), err
 }
 
-func processCmd(command string, pwd string) ([]string, error) {
+func processCmd(ctx context.Context, command string, pwd string, rc RunContext) ([]string, error) {
 	if err := os.Chdir(pwd); err != nil {
 		return []string{}, fmt.Errorf("cd %v has error: %w", pwd, err)
 	}
@@ -105,11 +107,18 @@ func processCmd(command string, pwd string) ([]string, error) {
 	if len(cmds) < 1 {
 		return []string{}, fmt.Errorf("invalid command line %s", command)
 	}
-	cmd := exec.Command(cmds[0], cmds[1:]...)
+	if rc.TemplateCommand {
+		cmds, err = renderCommand(cmds, rc)
+		if err != nil {
+			return []string{}, err
+		}
+	}
+	cmd := exec.CommandContext(ctx, cmds[0], cmds[1:]...)
+	cmd.Env = append(os.Environ(), rc.environ()...)
 	stdout, stderr, err := cmdOutput(cmd)
 	output := string(stdout)
 	if err != nil {
-		combinedOutput := fmt.Sprintf("%s\n%s", output, string(stderr))
+		combinedOutput := rc.Parameters.Redact(fmt.Sprintf("%s\n%s", output, string(stderr)))
 		return []string{}, fmt.Errorf("exec command %v has error: %w: %s", command, err, combinedOutput)
 	}
 	var outputs []string
@@ -0,0 +1,265 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/orchard"
+)
+
+// a backfill enqueues at most this many slots
+const maxBackfillSlots = 10000
+
+// a backfill fails once this many of its runs in a row couldn't be generated
+const maxBackfillFailures = 3
+
+// backfillSlots enumerates the slots of wf in [from, to). Fixed intervals
+// start at from, cron expressions at their first match not before from.
+func backfillSlots(wf table.Workflow, from time.Time, to time.Time) ([]time.Time, error) {
+	loc := workflowLocation(wf)
+	slot := from.In(loc)
+	if wf.Every.IsCron() {
+		slot = wf.Every.Cron.Next(slot.Add(-time.Second))
+	}
+	slots := []time.Time{}
+	for !slot.IsZero() && slot.Before(to) {
+		if len(slots) == maxBackfillSlots {
+			return nil, fmt.Errorf("a backfill can't have more than %d slots", maxBackfillSlots)
+		}
+		slots = append(slots, slot)
+		slot = addInterval(slot.In(loc), wf.Every, &from)
+	}
+	return slots, nil
+}
+
+// runBackfills creates the queued runs of the backfills that are not canceled
+// or failed, the ones of paused, inactive or deleted workflows wait
+func (s *Scheduler) runBackfills(db *gorm.DB) {
+	var backfills []table.Backfill
+
+	db.Model(&table.Backfill{}).
+		Joins("join workflows w on w.id = backfills.workflow_id").
+		Where("w.deleted_at is null and w.paused_at is null and w.is_active = ?", true).
+		Where("backfills.canceled_at is null and backfills.failed_at is null").
+		Where("exists (select 1 from scheduled_workflows s where s.backfill_id = backfills.id and s.status = ?)", Queued.ToString()).
+		Find(&backfills)
+
+	generation, _ := s.pools()
+	for _, bf := range backfills {
+		generation.submit(fmt.Sprintf("backfill:%d", bf.ID), func(ctx context.Context) { s.lockAndBackfill(ctx, db, bf) })
+	}
+}
+
+// lockAndBackfill creates queued runs of bf, oldest first, until it has
+// MaxParallelism runs in flight. It holds the scheduler lock of the workflow
+// so the cap isn't exceeded by concurrent schedulers. Runs that couldn't be
+// generated don't count against the cap, so the backfill fails once
+// maxBackfillFailures of them follow each other. The activated runs are
+// checked with orchard first, the cap doesn't wait on the reconciler.
+func (s *Scheduler) lockAndBackfill(ctx context.Context, db *gorm.DB, bf table.Backfill) {
+	wf := table.Workflow{}
+	if db.Limit(1).Find(&wf, bf.WorkflowID).RowsAffected == 0 {
+		return
+	}
+	token, ok := s.lockWorkflow(db, wf)
+	if !ok {
+		return
+	}
+	defer s.unlockWorkflow(db, wf, token)
+
+	client := &orchard.OrchardRestClient{
+		Host:       s.OrchardHost,
+		APIKeyName: s.OrchardAPIKeyName,
+		APIKey:     s.OrchardAPIKey,
+	}
+	var activated []table.ScheduledWorkflow
+	db.Where("backfill_id = ? and status = ?", bf.ID, Activated.ToString()).Find(&activated)
+	for _, swf := range activated {
+		s.reconcileWorkflow(db, client, swf)
+	}
+
+	var inFlight int64
+	db.Model(&table.ScheduledWorkflow{}).
+		Where("backfill_id = ? and status in ?", bf.ID, []string{Created.ToString(), Activated.ToString()}).
+		Count(&inFlight)
+	available := int64(bf.MaxParallelism) - inFlight
+	if available <= 0 {
+		return
+	}
+
+	var queued []table.ScheduledWorkflow
+	db.Where("backfill_id = ? and status = ?", bf.ID, Queued.ToString()).
+		Order("scheduled_start_time").
+		Limit(int(available)).
+		Find(&queued)
+
+	for _, swf := range queued {
+		rc := newRunContext(wf, swf.ScheduledStartTime, TriggerBackfill)
+		fmt.Println("creating backfill workflow", wf.Name, swf.ScheduledStartTime, rc.RunID, token)
+		statuses, err := s.createWorkflow(ctx, client, wf, rc)
+		swf.RunID = rc.RunID
+		swf.WorkflowVersion = wf.Version
+		if err := recordBackfillRun(db, swf, statuses, err); err != nil {
+			fmt.Printf("[error] error recording backfill run (name: %s, backfill_id: %v): %s\n", wf.Name, bf.ID, err)
+		}
+		if len(statuses) == 0 && generationFailures(db, bf) >= maxBackfillFailures {
+			if err := failBackfill(db, bf); err != nil {
+				fmt.Printf("[error] error failing backfill (name: %s, backfill_id: %v): %s\n", wf.Name, bf.ID, err)
+			}
+			return
+		}
+	}
+}
+
+// generationFailures counts the latest runs of bf that couldn't be generated,
+// up to maxBackfillFailures
+func generationFailures(db *gorm.DB, bf table.Backfill) int {
+	var latest []table.ScheduledWorkflow
+	db.Where("backfill_id = ? and status <> ?", bf.ID, Queued.ToString()).
+		Order("start_time desc, id desc").
+		Limit(maxBackfillFailures).
+		Find(&latest)
+	failures := 0
+	for _, swf := range latest {
+		if swf.Status != Failed.ToString() || swf.OrchardID != "" {
+			break
+		}
+		failures++
+	}
+	return failures
+}
+
+// failBackfill stops bf after its runs failed to generate, the last failure
+// is kept as the reason and the queued runs are canceled
+func failBackfill(db *gorm.DB, bf table.Backfill) error {
+	var last table.ScheduledWorkflow
+	db.Where("backfill_id = ? and status = ?", bf.ID, Failed.ToString()).
+		Order("start_time desc, id desc").
+		Limit(1).
+		Find(&last)
+	reason := fmt.Sprintf("%d runs in a row couldn't be generated, last: %s", maxBackfillFailures, last.Reason)
+	fmt.Printf("[warning] backfill (backfill_id: %v) failed: %s\n", bf.ID, reason)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&bf).Updates(map[string]interface{}{
+			"failed_at":      time.Now(),
+			"failure_reason": reason,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&table.ScheduledWorkflow{}).
+			Where("backfill_id = ? and status = ?", bf.ID, Queued.ToString()).
+			Updates(map[string]interface{}{
+				"status": Canceled.ToString(),
+				"reason": "backfill failed",
+			}).Error
+	})
+}
+
+// recordBackfillRun replaces the queued row with the orchard workflows created
+// for it, a generator outputting several of them gets one row each
+func recordBackfillRun(db *gorm.DB, swf table.ScheduledWorkflow, statuses map[string]string, createErr error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(statuses) == 0 {
+			reason := "no workflow generated"
+			if createErr != nil {
+				reason = createErr.Error()
+			}
+			return tx.Model(&swf).Updates(map[string]interface{}{
+				"status":           Failed.ToString(),
+				"reason":           reason,
+				"start_time":       time.Now(),
+				"run_id":           swf.RunID,
+				"workflow_version": swf.WorkflowVersion,
+			}).Error
+		}
+		first := true
+		for orchardID, status := range statuses {
+			if first {
+				first = false
+				if err := tx.Model(&swf).Updates(map[string]interface{}{
+					"orchard_id":       orchardID,
+					"status":           status,
+					"start_time":       time.Now(),
+					"run_id":           swf.RunID,
+					"workflow_version": swf.WorkflowVersion,
+				}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Create(&table.ScheduledWorkflow{
+				WorkflowID:         swf.WorkflowID,
+				OrchardID:          orchardID,
+				StartTime:          time.Now(),
+				ScheduledStartTime: swf.ScheduledStartTime,
+				Status:             status,
+				TriggerType:        TriggerBackfill,
+				BackfillID:         swf.BackfillID,
+				RunID:              swf.RunID,
+				WorkflowVersion:    swf.WorkflowVersion,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// cancelBackfill stops bf: queued runs are canceled, created ones deleted and
+// activated ones canceled in orchard. The orchard calls are made once the
+// backfill is marked canceled, outside of its transaction.
+func (s *Scheduler) cancelBackfill(db *gorm.DB, bf table.Backfill) error {
+	wf := table.Workflow{}
+	db.Unscoped().Limit(1).Find(&wf, bf.WorkflowID)
+	token, ok := s.lockWorkflow(db, wf)
+	if !ok {
+		return ErrWorkflowLocked
+	}
+	defer s.unlockWorkflow(db, wf, token)
+
+	var runs []table.ScheduledWorkflow
+	db.Where("backfill_id = ? and status in ?", bf.ID,
+		[]string{Queued.ToString(), Created.ToString(), Activated.ToString()}).
+		Find(&runs)
+
+	client := &orchard.OrchardRestClient{
+		Host:       s.OrchardHost,
+		APIKeyName: s.OrchardAPIKeyName,
+		APIKey:     s.OrchardAPIKey,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&bf).Update("canceled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(&table.ScheduledWorkflow{}).
+			Where("backfill_id = ? and status = ?", bf.ID, Queued.ToString()).
+			Update("status", Canceled.ToString()).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, swf := range runs {
+		var status string
+		switch swf.Status {
+		case Created.ToString():
+			status = s.deleteWorkflows(client, []string{swf.OrchardID}, map[string]string{})[swf.OrchardID]
+		case Activated.ToString():
+			status = s.cancelWorkflows(client, map[string]string{swf.OrchardID: swf.Status})[swf.OrchardID]
+		default:
+			continue
+		}
+		if err := db.Model(&swf).Update("status", status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+func TestBackfillSlots(t *testing.T) {
+	from := time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)
+
+	t.Run("Fixed interval starts at from", func(t *testing.T) {
+		wf := table.Workflow{Every: model.Every{Quantity: 1, Unit: model.EveryDay}}
+		slots, err := backfillSlots(wf, from, from.AddDate(0, 0, 3))
+		assert.NoError(t, err)
+		assert.Equal(t, []time.Time{from, from.AddDate(0, 0, 1), from.AddDate(0, 0, 2)}, slots)
+	})
+
+	t.Run("Cron starts at its first match", func(t *testing.T) {
+		every, err := model.ParseEvery("0 0 * * *")
+		assert.NoError(t, err)
+		slots, err := backfillSlots(table.Workflow{Every: every}, from, from.AddDate(0, 0, 2))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(slots))
+		assert.True(t, slots[0].Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)))
+	})
+
+	t.Run("Too many slots", func(t *testing.T) {
+		wf := table.Workflow{Every: model.Every{Quantity: 1, Unit: model.EveryMinute}}
+		_, err := backfillSlots(wf, from, from.AddDate(0, 1, 0))
+		assert.Error(t, err)
+	})
+}
+
+func TestLockAndBackfill(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+
+	orchardStatus := "running"
+	orchardServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"id":"wf-backfill","name":"backfill","status":"%s","createdAt":""}`, orchardStatus)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer orchardServer.Close()
+	// without the reconciler
+	scheduler := &Scheduler{OrchardHost: orchardServer.URL}
+
+	wf := table.Workflow{
+		Name:        "backfill_test",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
+		NextRuntime: time.Now(),
+	}
+	assert.NoError(t, mockDB.Create(&wf).Error)
+	bf := table.Backfill{WorkflowID: wf.ID, MaxParallelism: 2}
+	assert.NoError(t, mockDB.Create(&bf).Error)
+
+	slot := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i, status := range []string{Activated.ToString(), Created.ToString(), Queued.ToString(), Queued.ToString()} {
+		assert.NoError(t, mockDB.Create(&table.ScheduledWorkflow{
+			WorkflowID:         wf.ID,
+			StartTime:          time.Now(),
+			ScheduledStartTime: slot.AddDate(0, 0, i),
+			Status:             status,
+			TriggerType:        TriggerBackfill,
+			BackfillID:         &bf.ID,
+		}).Error)
+	}
+	countStatus := func(status string) int64 {
+		var count int64
+		mockDB.Model(&table.ScheduledWorkflow{}).Where("backfill_id = ? and status = ?", bf.ID, status).Count(&count)
+		return count
+	}
+
+	t.Run("Nothing is created at the cap", func(t *testing.T) {
+		scheduler.lockAndBackfill(context.Background(), mockDB, bf)
+		assert.Equal(t, int64(2), countStatus(Queued.ToString()))
+	})
+
+	t.Run("Oldest queued slot is created below the cap", func(t *testing.T) {
+		bf.MaxParallelism = 3
+		scheduler.lockAndBackfill(context.Background(), mockDB, bf)
+		assert.Equal(t, int64(1), countStatus(Queued.ToString()))
+		// test.jar can't be generated
+		var run table.ScheduledWorkflow
+		mockDB.Where("backfill_id = ? and status = ?", bf.ID, Failed.ToString()).First(&run)
+		assert.True(t, run.ScheduledStartTime.Equal(slot.AddDate(0, 0, 2)))
+	})
+
+	t.Run("Activated run over in orchard frees its slot", func(t *testing.T) {
+		bf.MaxParallelism = 2
+		orchardStatus = "finished"
+		scheduler.lockAndBackfill(context.Background(), mockDB, bf)
+		assert.Equal(t, int64(1), countStatus(Finished.ToString()))
+		assert.Equal(t, int64(0), countStatus(Queued.ToString()))
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		assert.NoError(t, scheduler.cancelBackfill(mockDB, bf))
+		assert.Equal(t, int64(0), countStatus(Queued.ToString()))
+		mockDB.First(&bf, bf.ID)
+		assert.NotNil(t, bf.CanceledAt)
+	})
+
+	cleanupDB(mockDB, dbName)
+}
+
+func TestLockAndBackfillFailures(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	scheduler := &Scheduler{}
+
+	wf := table.Workflow{
+		Name:        "backfill_failures_test",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
+		NextRuntime: time.Now(),
+	}
+	assert.NoError(t, mockDB.Create(&wf).Error)
+	bf := table.Backfill{WorkflowID: wf.ID, MaxParallelism: 10}
+	assert.NoError(t, mockDB.Create(&bf).Error)
+
+	slot := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxBackfillFailures+2; i++ {
+		assert.NoError(t, mockDB.Create(&table.ScheduledWorkflow{
+			WorkflowID:         wf.ID,
+			StartTime:          time.Now(),
+			ScheduledStartTime: slot.AddDate(0, 0, i),
+			Status:             Queued.ToString(),
+			TriggerType:        TriggerBackfill,
+			BackfillID:         &bf.ID,
+		}).Error)
+	}
+	countStatus := func(status string) int64 {
+		var count int64
+		mockDB.Model(&table.ScheduledWorkflow{}).Where("backfill_id = ? and status = ?", bf.ID, status).Count(&count)
+		return count
+	}
+
+	// test.jar can't be generated
+	scheduler.lockAndBackfill(context.Background(), mockDB, bf)
+	assert.Equal(t, int64(maxBackfillFailures), countStatus(Failed.ToString()))
+	assert.Equal(t, int64(2), countStatus(Canceled.ToString()))
+	assert.Equal(t, int64(0), countStatus(Queued.ToString()))
+
+	mockDB.First(&bf, bf.ID)
+	assert.NotNil(t, bf.FailedAt)
+	assert.Contains(t, bf.FailureReason, "runs in a row couldn't be generated")
+
+	cleanupDB(mockDB, dbName)
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/metrics"
+)
+
+// how schedulers claim the workflows and runs they process
+const (
+	// a row in the lock tables, expired by the cleanup service
+	ClaimModeLock = "lock"
+	// a lease on the claimed row itself, renewed while held and free once expired
+	ClaimModeLease = "lease"
+)
+
+const defaultLeaseDuration = time.Minute
+
+// errClaimLost is returned when the lock or lease of a workflow was lost, or
+// the workflow was moved on, before its runs were recorded
+var errClaimLost = errors.New("workflow claim lost")
+
+// locks of the lock claim mode
+const (
+	lockScheduler = "scheduler"
+	lockActivator = "activator"
+)
+
+func init() {
+	metrics.AddCounter("scheduler_lock_takeovers_total", "Number of stale locks taken over from another scheduler", []string{"lock"})
+}
+
+func ValidClaimMode(mode string) bool {
+	return mode == "" || mode == ClaimModeLock || mode == ClaimModeLease
+}
+
+func (s *Scheduler) leaseMode() bool {
+	return s.ClaimMode == ClaimModeLease
+}
+
+func (s *Scheduler) leaseDuration() time.Duration {
+	if s.LeaseDuration <= 0 {
+		return defaultLeaseDuration
+	}
+	return s.LeaseDuration
+}
+
+// heartbeatInterval is how often the lock time of the locks held is
+// refreshed, often enough for them not to look stale
+func (s *Scheduler) heartbeatInterval() time.Duration {
+	if s.LockTTL <= 0 {
+		return defaultLeaseDuration / 3
+	}
+	return s.LockTTL / 3
+}
+
+// staleLockTime is the lock time before which a lock is taken over, zero if
+// locks are never taken over
+func (s *Scheduler) staleLockTime() time.Time {
+	if s.LockTTL <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-s.LockTTL)
+}
+
+// unclaimed keeps the rows of query without a lease, in the lease claim mode,
+// or without a lock that is not stale, in the lock claim mode. The lock table
+// is joined as l.
+func (s *Scheduler) unclaimed(query *gorm.DB, tableName string) *gorm.DB {
+	if !s.leaseMode() {
+		if stale := s.staleLockTime(); !stale.IsZero() {
+			return query.Where("(l.token is null or l.lock_time < ?)", stale)
+		}
+		return query.Where("l.token is null")
+	}
+	return query.Where(
+		fmt.Sprintf("(%s.claim_expires_at is null or %s.claim_expires_at < ?)", tableName, tableName),
+		time.Now(),
+	)
+}
+
+// claimLease atomically takes the lease of the row of model with the given
+// id if it is free or expired, and the conditions hold
+func claimLease(db *gorm.DB, model interface{}, id uint, token string, duration time.Duration, conditions ...interface{}) bool {
+	now := time.Now()
+	query := db.Model(model).Where("id = ? and (claim_expires_at is null or claim_expires_at < ?)", id, now)
+	if len(conditions) > 0 {
+		query = query.Where(conditions[0], conditions[1:]...)
+	}
+	result := query.UpdateColumns(map[string]interface{}{
+		"claim_token":      token,
+		"claim_expires_at": now.Add(duration),
+	})
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// renewLease extends the lease held with token, reporting whether it is
+// still held
+func renewLease(db *gorm.DB, model interface{}, id uint, token string, duration time.Duration) bool {
+	result := db.Model(model).
+		Where("id = ? and claim_token = ?", id, token).
+		UpdateColumn("claim_expires_at", time.Now().Add(duration))
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func releaseLease(db *gorm.DB, model interface{}, id uint, token string) {
+	db.Model(model).
+		Where("id = ? and claim_token = ?", id, token).
+		UpdateColumns(map[string]interface{}{"claim_token": "", "claim_expires_at": nil})
+}
+
+// keepAlive calls refresh every interval until the returned stop is called
+func keepAlive(interval time.Duration, refresh func()) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// heldClaim is a lock or lease held by the scheduler
+type heldClaim struct {
+	// stops refreshing it
+	stop func()
+}
+
+// leaseHeartbeat renews a lease held with token until it is released
+func (s *Scheduler) leaseHeartbeat(db *gorm.DB, model interface{}, id uint, token string) {
+	duration := s.leaseDuration()
+	stop := keepAlive(duration/3, func() {
+		if !renewLease(db, model, id, token, duration) {
+			fmt.Printf("[warning] lease lost (id: %d, token: %s)\n", id, token)
+		}
+	})
+	s.claims.Store(token, heldClaim{stop: stop})
+}
+
+func (s *Scheduler) stopHeartbeat(token string) {
+	if claim, ok := s.claims.LoadAndDelete(token); ok {
+		claim.(heldClaim).stop()
+	}
+}
+
+// abandonClaims stops refreshing the locks and leases still held at the
+// shutdown, by work that didn't stop once canceled. They are not released
+// since that work may still create runs: they expire and are taken over by
+// another scheduler, or removed by the cleanup service.
+func (s *Scheduler) abandonClaims() {
+	s.claims.Range(func(token, claim interface{}) bool {
+		if _, ok := s.claims.LoadAndDelete(token); ok {
+			claim.(heldClaim).stop()
+			fmt.Printf("[warning] claim (token: %s) still held at shutdown, left to expire\n", token)
+		}
+		return true
+	})
+}
+
+// takeOverStaleLock deletes the lock of model matching the query if its
+// holder stopped refreshing it for longer than the lock TTL
+func (s *Scheduler) takeOverStaleLock(db *gorm.DB, lock string, model interface{}, query string, id uint) {
+	stale := s.staleLockTime()
+	if stale.IsZero() {
+		return
+	}
+	var existing struct {
+		Token    string
+		LockTime time.Time
+	}
+	if db.Model(model).Where(query+" and lock_time < ?", id, stale).Limit(1).Find(&existing).RowsAffected == 0 {
+		return
+	}
+	result := db.Where(query+" and token = ? and lock_time < ?", id, existing.Token, stale).Delete(model)
+	if result.Error != nil || result.RowsAffected == 0 {
+		// refreshed or taken over by another scheduler meanwhile
+		return
+	}
+	fmt.Printf("[warning] took over stale %s lock (id: %d, token: %s, lock_time: %s)\n", lock, id, existing.Token, existing.LockTime)
+	metrics.IncrementCounter("scheduler_lock_takeovers_total", map[string]string{"lock": lock})
+}
+
+// lockHeartbeat refreshes the lock time of a lock held with token until it
+// is released
+func (s *Scheduler) lockHeartbeat(db *gorm.DB, lock string, model interface{}, query string, id uint, token string) {
+	stop := keepAlive(s.heartbeatInterval(), func() {
+		result := db.Model(model).Where(query+" and token = ?", id, token).Update("lock_time", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			fmt.Printf("[warning] %s lock lost (id: %d, token: %s)\n", lock, id, token)
+		}
+	})
+	s.claims.Store(token, heldClaim{stop: stop})
+}
+
+// lockWorkflow claims wf so that a single scheduler creates its runs,
+// returning the token to unlock it with. The workflow is only claimed while
+// the conditions hold.
+func (s *Scheduler) lockWorkflow(db *gorm.DB, wf table.Workflow, conditions ...interface{}) (string, bool) {
+	if !s.leaseMode() {
+		s.takeOverStaleLock(db, lockScheduler, &table.WorkflowSchedulerLock{}, "workflow_id = ?", wf.ID)
+		token, ok := lockWorkflow(db, wf)
+		if !ok {
+			return "", false
+		}
+		if len(conditions) > 0 {
+			// the row read before the lock was taken may be outdated
+			var matching int64
+			db.Model(&table.Workflow{}).Where("id = ?", wf.ID).Where(conditions[0], conditions[1:]...).Count(&matching)
+			if matching == 0 {
+				fmt.Printf("workflow (name: %s, workflow_id: %v) was moved on by another scheduler! skip...\n", wf.Name, wf.ID)
+				unlockWorkflow(db, wf, token)
+				return "", false
+			}
+		}
+		s.lockHeartbeat(db, lockScheduler, &table.WorkflowSchedulerLock{}, "workflow_id = ?", wf.ID, token)
+		return token, true
+	}
+	token := uuid.New().String()
+	if !claimLease(db, &table.Workflow{}, wf.ID, token, s.leaseDuration(), conditions...) {
+		fmt.Printf("something else is creating this workflow (name: %s, workflow_id: %v)! skip...\n", wf.Name, wf.ID)
+		return "", false
+	}
+	s.leaseHeartbeat(db, &table.Workflow{}, wf.ID, token)
+	return token, true
+}
+
+// holdsWorkflow reports whether the lock or lease of wf taken with token is
+// still held
+func (s *Scheduler) holdsWorkflow(db *gorm.DB, wf table.Workflow, token string) bool {
+	var held int64
+	if s.leaseMode() {
+		db.Model(&table.Workflow{}).Where("id = ? and claim_token = ?", wf.ID, token).Count(&held)
+	} else {
+		db.Model(&table.WorkflowSchedulerLock{}).Where("workflow_id = ? and token = ?", wf.ID, token).Count(&held)
+	}
+	return held == 1
+}
+
+func (s *Scheduler) unlockWorkflow(db *gorm.DB, wf table.Workflow, token string) {
+	if !s.leaseMode() {
+		s.stopHeartbeat(token)
+		unlockWorkflow(db, wf, token)
+		return
+	}
+	s.stopHeartbeat(token)
+	releaseLease(db, &table.Workflow{}, wf.ID, token)
+}
+
+// lockRun claims swf so that a single scheduler activates it, returning the
+// token to unlock it with
+func (s *Scheduler) lockRun(db *gorm.DB, swf table.ScheduledWorkflow) (string, bool) {
+	token := uuid.New().String()
+	if s.leaseMode() {
+		if !claimLease(db, &table.ScheduledWorkflow{}, swf.ID, token, s.leaseDuration(), "status = ?", Created.ToString()) {
+			fmt.Printf("something else is activating this scheduled workflow (scheduled_workflow_id: %v)! skip...\n", swf.ID)
+			return "", false
+		}
+		s.leaseHeartbeat(db, &table.ScheduledWorkflow{}, swf.ID, token)
+		return token, true
+	}
+
+	s.takeOverStaleLock(db, lockActivator, &table.WorkflowActivatorLock{}, "scheduled_id = ?", swf.ID)
+	lock := table.WorkflowActivatorLock{
+		ScheduledID: swf.ID,
+		Token:       token,
+		LockTime:    time.Now(),
+	}
+	result := db.Create(&lock)
+	if result.Error != nil {
+		fmt.Printf("something else is activating this scheduled workflow (scheduled_workflow_id: %v)! skip...\n", swf.ID)
+		return "", false
+	}
+
+	existingLock := table.WorkflowActivatorLock{}
+	db.First(&existingLock, swf.ID)
+
+	if existingLock.Token != token {
+		fmt.Printf("something else is activating this scheduled workflow (scheduled_workflow_id: %v)! skip...\n", swf.ID)
+		return "", false
+	}
+	s.lockHeartbeat(db, lockActivator, &table.WorkflowActivatorLock{}, "scheduled_id = ?", swf.ID, token)
+	return token, true
+}
+
+func (s *Scheduler) unlockRun(db *gorm.DB, swf table.ScheduledWorkflow, token string) {
+	if s.leaseMode() {
+		s.stopHeartbeat(token)
+		releaseLease(db, &table.ScheduledWorkflow{}, swf.ID, token)
+		return
+	}
+	s.stopHeartbeat(token)
+	db.Where("scheduled_id = ? and token = ?", swf.ID, token).
+		Delete(&table.WorkflowActivatorLock{})
+}
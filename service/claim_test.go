@@ -0,0 +1,171 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+func TestLeaseClaims(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	first := &Scheduler{ClaimMode: ClaimModeLease, LeaseDuration: 300 * time.Millisecond}
+	second := &Scheduler{ClaimMode: ClaimModeLease, LeaseDuration: 300 * time.Millisecond}
+
+	var wf table.Workflow
+	mockDB.Where("name = ?", getTestName).First(&wf)
+	reload := func() table.Workflow {
+		var current table.Workflow
+		mockDB.First(&current, wf.ID)
+		return current
+	}
+
+	t.Run("A single scheduler holds the lease", func(t *testing.T) {
+		token, ok := first.lockWorkflow(mockDB, wf)
+		assert.True(t, ok)
+		_, ok = second.lockWorkflow(mockDB, wf)
+		assert.False(t, ok)
+		assert.Equal(t, token, reload().ClaimToken)
+
+		// renewed past its duration while held
+		time.Sleep(500 * time.Millisecond)
+		assert.True(t, reload().ClaimExpiresAt.After(time.Now()))
+		_, ok = second.lockWorkflow(mockDB, wf)
+		assert.False(t, ok)
+
+		first.unlockWorkflow(mockDB, wf, token)
+		assert.Equal(t, "", reload().ClaimToken)
+		assert.Nil(t, reload().ClaimExpiresAt)
+		token, ok = second.lockWorkflow(mockDB, wf)
+		assert.True(t, ok)
+		second.unlockWorkflow(mockDB, wf, token)
+	})
+
+	t.Run("An expired lease is taken over", func(t *testing.T) {
+		expired := time.Now().Add(-time.Second)
+		mockDB.Model(&wf).UpdateColumns(map[string]interface{}{"claim_token": "crashed", "claim_expires_at": expired})
+		token, ok := second.lockWorkflow(mockDB, wf)
+		assert.True(t, ok)
+		second.unlockWorkflow(mockDB, wf, token)
+	})
+
+	t.Run("Stale workflows are not claimed", func(t *testing.T) {
+		stale := wf
+		stale.NextRuntime = wf.NextRuntime.Add(-time.Hour)
+		_, ok := first.lockWorkflow(mockDB, stale, "next_runtime = ?", stale.NextRuntime)
+		assert.False(t, ok)
+	})
+
+	t.Run("Only created runs are claimed", func(t *testing.T) {
+		created := table.ScheduledWorkflow{WorkflowID: wf.ID, StartTime: time.Now(), ScheduledStartTime: time.Now(), Status: Created.ToString()}
+		activated := table.ScheduledWorkflow{WorkflowID: wf.ID, StartTime: time.Now(), ScheduledStartTime: time.Now(), Status: Activated.ToString()}
+		assert.NoError(t, mockDB.Create(&created).Error)
+		assert.NoError(t, mockDB.Create(&activated).Error)
+
+		token, ok := first.lockRun(mockDB, created)
+		assert.True(t, ok)
+		_, ok = second.lockRun(mockDB, created)
+		assert.False(t, ok)
+		_, ok = second.lockRun(mockDB, activated)
+		assert.False(t, ok)
+
+		var due []table.ScheduledWorkflow
+		second.unclaimed(mockDB.Model(&table.ScheduledWorkflow{}), "scheduled_workflows").Find(&due)
+		assert.Equal(t, 1, len(due))
+		assert.Equal(t, activated.ID, due[0].ID)
+		first.unlockRun(mockDB, created, token)
+		second.unclaimed(mockDB.Model(&table.ScheduledWorkflow{}), "scheduled_workflows").Find(&due)
+		assert.Equal(t, 2, len(due))
+	})
+
+	cleanupDB(mockDB, dbName)
+}
+
+func TestLockTakeover(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	first := &Scheduler{LockTTL: 300 * time.Millisecond}
+	second := &Scheduler{LockTTL: 300 * time.Millisecond}
+
+	var wf, other table.Workflow
+	mockDB.Where("name = ?", getTestName).First(&wf)
+	mockDB.Where("name = ?", deleteTestName).First(&other)
+	unlocked := func() []string {
+		var workflows []table.Workflow
+		query := mockDB.Model(&table.Workflow{}).
+			Joins("left join workflow_scheduler_locks l on workflows.id = l.workflow_id")
+		second.unclaimed(query, "workflows").Order("name").Find(&workflows)
+		names := []string{}
+		for _, workflow := range workflows {
+			names = append(names, workflow.Name)
+		}
+		return names
+	}
+
+	t.Run("Held locks are refreshed", func(t *testing.T) {
+		token, ok := first.lockWorkflow(mockDB, wf)
+		assert.True(t, ok)
+		time.Sleep(500 * time.Millisecond)
+		_, ok = second.lockWorkflow(mockDB, wf)
+		assert.False(t, ok)
+		assert.NotContains(t, unlocked(), getTestName)
+
+		first.unlockWorkflow(mockDB, wf, token)
+		assert.Contains(t, unlocked(), getTestName)
+	})
+
+	t.Run("Stale locks are taken over", func(t *testing.T) {
+		stale := time.Now().Add(-time.Second)
+		assert.NoError(t, mockDB.Create(&table.WorkflowSchedulerLock{WorkflowID: other.ID, Token: "crashed", LockTime: stale}).Error)
+		assert.Contains(t, unlocked(), deleteTestName)
+		token, ok := second.lockWorkflow(mockDB, other)
+		assert.True(t, ok)
+		var lock table.WorkflowSchedulerLock
+		mockDB.First(&lock, other.ID)
+		assert.Equal(t, token, lock.Token)
+		second.unlockWorkflow(mockDB, other, token)
+
+		swf := table.ScheduledWorkflow{WorkflowID: wf.ID, StartTime: time.Now(), ScheduledStartTime: time.Now(), Status: Created.ToString()}
+		assert.NoError(t, mockDB.Create(&swf).Error)
+		assert.NoError(t, mockDB.Create(&table.WorkflowActivatorLock{ScheduledID: swf.ID, Token: "crashed", LockTime: stale}).Error)
+		token, ok = second.lockRun(mockDB, swf)
+		assert.True(t, ok)
+		second.unlockRun(mockDB, swf, token)
+	})
+
+	t.Run("Stale workflows are not locked", func(t *testing.T) {
+		stale := wf
+		stale.NextRuntime = wf.NextRuntime.Add(-time.Hour)
+		_, ok := first.lockWorkflow(mockDB, stale, "next_runtime = ?", stale.NextRuntime)
+		assert.False(t, ok)
+		assert.Contains(t, unlocked(), getTestName)
+	})
+
+	t.Run("A lock taken over is not held anymore", func(t *testing.T) {
+		token, ok := first.lockWorkflow(mockDB, wf)
+		assert.True(t, ok)
+		assert.True(t, first.holdsWorkflow(mockDB, wf, token))
+		first.stopHeartbeat(token)
+		mockDB.Model(&table.WorkflowSchedulerLock{}).Where("workflow_id = ?", wf.ID).Update("token", "other")
+		assert.False(t, first.holdsWorkflow(mockDB, wf, token))
+		mockDB.Where("workflow_id = ?", wf.ID).Delete(&table.WorkflowSchedulerLock{})
+	})
+
+	t.Run("Locks are not taken over without a TTL", func(t *testing.T) {
+		stale := time.Now().Add(-time.Hour)
+		assert.NoError(t, mockDB.Create(&table.WorkflowSchedulerLock{WorkflowID: other.ID, Token: "crashed", LockTime: stale}).Error)
+		_, ok := (&Scheduler{}).lockWorkflow(mockDB, other)
+		assert.False(t, ok)
+	})
+
+	cleanupDB(mockDB, dbName)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"gorm.io/gorm"
 	"mce.salesforce.com/sprinkler/database"
@@ -12,13 +13,35 @@ type Cleanup struct {
 	ScheduledWorkflowTimeout      time.Duration
 	WorkflowActivationLockTimeout time.Duration
 	WorkflowSchedulerLockTimeout  time.Duration
+	// deleted workflows are purged after it, 0 disables the purge
+	DeletedWorkflowRetention time.Duration
+	// only report what would be purged
+	PurgeDryRun bool
 }
 
 func (s *Cleanup) Run() {
+	s.sweep(database.GetInstance())
+}
+
+// startCleanup runs the cleanup sweep on the leading scheduler
+func (s *Scheduler) startCleanup(ctx context.Context) {
+	if s.Cleanup == nil || s.CleanupInterval <= 0 {
+		return
+	}
+	every(ctx, s.CleanupInterval, func() {
+		if s.isLeader() {
+			s.Cleanup.sweep(database.GetInstance())
+		}
+	})
+}
+
+// sweep runs every cleanup task
+func (s *Cleanup) sweep(db *gorm.DB) {
 	fmt.Println("Cleanup started")
-	s.deleteExpiredActivatorLocks(database.GetInstance())
-	s.deleteExpiredSchedulerLocks(database.GetInstance())
-	s.deleteExpiredScheduledWorkflows(database.GetInstance())
+	s.deleteExpiredActivatorLocks(db)
+	s.deleteExpiredSchedulerLocks(db)
+	s.deleteExpiredScheduledWorkflows(db)
+	s.purgeDeletedWorkflows(db)
 	fmt.Println("Cleanup complete")
 }
 
@@ -48,3 +71,18 @@ func (s *Cleanup) deleteExpiredScheduledWorkflows(db *gorm.DB) {
 		Where("updated_at < ?", expiryTime).
 		Unscoped().Delete(&table.ScheduledWorkflow{})
 }
+
+func (s *Cleanup) purgeDeletedWorkflows(db *gorm.DB) {
+	if s.DeletedWorkflowRetention <= 0 {
+		return
+	}
+	deletedBefore := time.Now().Add(-s.DeletedWorkflowRetention)
+	fmt.Printf("Purging workflows deleted before %s ...\n", deletedBefore)
+
+	report, err := purgeWorkflows(db, deletedBefore, s.PurgeDryRun)
+	if err != nil {
+		fmt.Printf("[error] error purging deleted workflows: %s\n", err)
+		return
+	}
+	fmt.Println(report)
+}
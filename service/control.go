@@ -9,11 +9,13 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -24,6 +26,7 @@ import (
 	"mce.salesforce.com/sprinkler/database/table"
 	"mce.salesforce.com/sprinkler/metrics"
 	"mce.salesforce.com/sprinkler/model"
+	"mce.salesforce.com/sprinkler/orchard"
 )
 
 type Control struct {
@@ -35,18 +38,51 @@ type Control struct {
 	xfccEnabled     bool
 	xfccHeaderName  string
 	xfccMustContain string
+	// creates the runs triggered through the control service
+	scheduler *Scheduler
 }
 
 type putWorkflowReq struct {
-	Name                 string    `json:"name" binding:"required"`
-	Artifact             string    `json:"artifact" binding:"required"`
-	Command              string    `json:"command" binding:"required"`
-	Every                string    `json:"every" binding:"required"`
-	NextRuntime          time.Time `json:"nextRuntime" binding:"required"`
-	Backfill             bool      `json:"backfill"` // default false if absent
-	Owner                *string   `json:"owner"`
-	IsActive             bool      `json:"isActive"` // default false if absent
-	ScheduleDelayMinutes uint      `json:"scheduleDelayMinutes"`
+	Name                     string           `json:"name" binding:"required"`
+	Artifact                 string           `json:"artifact" binding:"required"`
+	Command                  string           `json:"command" binding:"required"`
+	Every                    string           `json:"every" binding:"required"`
+	NextRuntime              time.Time        `json:"nextRuntime" binding:"required"`
+	Backfill                 bool             `json:"backfill"` // deprecated, true stands for the fire_all misfire policy
+	Owner                    *string          `json:"owner"`
+	IsActive                 bool             `json:"isActive"` // default false if absent
+	ScheduleDelayMinutes     uint             `json:"scheduleDelayMinutes"`
+	Timezone                 string           `json:"timezone"`                 // IANA name, default UTC if absent
+	Calendars                []string         `json:"calendars"`                // blackout calendar names
+	EndTime                  *time.Time       `json:"endTime"`                  // no run scheduled after it if present
+	MaxRuns                  uint             `json:"maxRuns"`                  // no limit if absent
+	MisfirePolicy            string           `json:"misfirePolicy"`            // fire_all, fire_once_now, skip or fire_last_n
+	MisfireLastN             uint             `json:"misfireLastN"`             // missed runs kept by fire_last_n
+	MaxCatchUpMinutes        uint             `json:"maxCatchUpMinutes"`        // no limit if absent
+	OverlapPolicy            string           `json:"overlapPolicy"`            // allow, forbid, queue or replace, default allow if absent
+	DependsOn                []string         `json:"dependsOn"`                // upstream workflow names
+	DependencyTimeoutMinutes uint             `json:"dependencyTimeoutMinutes"` // scheduler default if absent
+	Parameters               model.Parameters `json:"parameters"`               // generator environment and command template values
+	TemplateCommand          bool             `json:"templateCommand"`          // command arguments are templates, default false if absent
+	Labels                   model.Labels     `json:"labels"`                   // free-form, for label selectors
+	Team                     string           `json:"team"`                     // owning team
+}
+
+// getWorkflowResp is putWorkflowReq along with the fields maintained by
+// sprinkler itself
+type getWorkflowResp struct {
+	putWorkflowReq
+	RunCount    uint       `json:"runCount"`
+	Paused      bool       `json:"paused"`
+	PausedAt    *time.Time `json:"pausedAt,omitempty"`
+	PausedBy    string     `json:"pausedBy,omitempty"` // pausedBy and pauseReason are kept once resumed
+	PauseReason string     `json:"pauseReason,omitempty"`
+	ResumeAt    *time.Time `json:"resumeAt,omitempty"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+
+	ResumedAt    *time.Time `json:"resumedAt,omitempty"`
+	ResumedBy    string     `json:"resumedBy,omitempty"`
+	ResumeReason string     `json:"resumeReason,omitempty"`
 }
 
 type deleteWorkflowReq struct {
@@ -59,7 +95,7 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
-func NewControl(db *gorm.DB, address string, trustedProxies []string, apiKeyEnabled bool, apiKey string, xfccEnabled bool, xfccHeaderName string, xfccMustContain string) *Control {
+func NewControl(db *gorm.DB, address string, trustedProxies []string, apiKeyEnabled bool, apiKey string, xfccEnabled bool, xfccHeaderName string, xfccMustContain string, scheduler *Scheduler) *Control {
 	return &Control{
 		db:              db,
 		address:         address,
@@ -69,6 +105,7 @@ func NewControl(db *gorm.DB, address string, trustedProxies []string, apiKeyEnab
 		xfccEnabled:     xfccEnabled,
 		xfccHeaderName:  xfccHeaderName,
 		xfccMustContain: xfccMustContain,
+		scheduler:       scheduler,
 	}
 }
 
@@ -80,35 +117,237 @@ func (ctrl *Control) putWorkflow(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
+	version, ok := ctrl.ifMatchVersion(c, body.Name)
+	if !ok {
+		return
+	}
 
-	every, err := model.ParseEvery(body.Every)
+	wf, associations, err := ctrl.workflowFromReq(body)
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	wf := table.Workflow{
-		Name:                 body.Name,
-		Artifact:             body.Artifact,
-		Command:              body.Command,
-		Every:                every,
-		NextRuntime:          body.NextRuntime,
-		Backfill:             body.Backfill,
-		Owner:                body.Owner,
-		IsActive:             body.IsActive,
-		ScheduleDelayMinutes: body.ScheduleDelayMinutes,
-	}
-	// upsert workflow
-	ctrl.db.Clauses(
-		clause.OnConflict{
-			Columns:   []clause.Column{{Name: "name"}},
-			DoUpdates: clause.AssignmentColumns([]string{"updated_at", "artifact", "command", "every", "next_runtime", "backfill", "owner", "is_active", "schedule_delay_minutes"}),
-		}).Create(&wf)
-	ctrl.db.Unscoped().Model(&wf).Update("deleted_at", nil)
+	columns := []string{"artifact", "command", "every", "next_runtime", "backfill", "owner", "is_active", "schedule_delay_minutes", "timezone", "schedule_anchor", "end_time", "max_runs", "misfire_policy", "misfire_last_n", "max_catch_up_minutes", "overlap_policy", "dependency_timeout_minutes", "parameters", "template_command", "team"}
+	if body.IsActive {
+		// activating the workflow ends its pause
+		columns = append(columns, pauseColumns...)
+	}
+	var current table.Workflow
+	if ctrl.db.Unscoped().Where("name = ?", wf.Name).Limit(1).Find(&current).RowsAffected == 1 {
+		columns = restartRunCount(current, wf, columns)
+	}
+	wf, err = ctrl.saveWorkflow(wf, columns, version, associations, versionPut)
+	if !ctrl.savedWorkflow(c, body.Name, err) {
+		return
+	}
+	c.Header("ETag", workflowETag(wf))
 	c.JSON(http.StatusOK, "OK")
 }
 
+// workflowAssociations are the rows linked to a workflow definition, the nil
+// ones are left alone by saveWorkflow
+type workflowAssociations struct {
+	calendars *[]table.Calendar
+	upstreams *[]table.Workflow
+	labels    *[]table.WorkflowLabel
+}
+
+// workflowFromReq validates body and builds the workflow row it describes,
+// along with its calendars, upstream workflows and labels
+func (ctrl *Control) workflowFromReq(body putWorkflowReq) (table.Workflow, workflowAssociations, error) {
+	none := workflowAssociations{}
+	every, err := model.ParseEvery(body.Every)
+	if err != nil {
+		return table.Workflow{}, none, err
+	}
+
+	if err := body.Parameters.Validate(); err != nil {
+		return table.Workflow{}, none, err
+	}
+	keepSecrets(ctrl.db, body.Name, body.Parameters)
+
+	if body.TemplateCommand {
+		if err := orchard.ValidateCommand(body.Command, body.Parameters); err != nil {
+			return table.Workflow{}, none, err
+		}
+	}
+
+	if body.Timezone == "" {
+		body.Timezone = model.DefaultTimezone
+	}
+	if _, err := model.LoadTimezone(body.Timezone); err != nil {
+		return table.Workflow{}, none, err
+	}
+
+	if body.EndTime != nil && body.EndTime.Before(body.NextRuntime) {
+		return table.Workflow{}, none, errors.New("endTime must not be before nextRuntime")
+	}
+
+	misfirePolicy := model.MisfirePolicyOf("", body.Backfill)
+	if body.MisfirePolicy != "" {
+		if misfirePolicy, err = model.ParseMisfirePolicy(body.MisfirePolicy); err != nil {
+			return table.Workflow{}, none, err
+		}
+	}
+	if misfirePolicy == model.MisfireFireLastN && body.MisfireLastN == 0 {
+		return table.Workflow{}, none, errors.New("misfireLastN must be positive for the fire_last_n misfire policy")
+	}
+
+	overlapPolicy, err := model.ParseOverlapPolicy(body.OverlapPolicy)
+	if err != nil {
+		return table.Workflow{}, none, err
+	}
+
+	calendars, err := findCalendars(ctrl.db, body.Calendars)
+	if err != nil {
+		return table.Workflow{}, none, err
+	}
+
+	upstreams, err := findUpstreams(ctrl.db, body.Name, body.DependsOn)
+	if err != nil {
+		return table.Workflow{}, none, err
+	}
+
+	if err := body.Labels.Validate(); err != nil {
+		return table.Workflow{}, none, err
+	}
+	labels := []table.WorkflowLabel{}
+	for name, value := range body.Labels {
+		labels = append(labels, table.WorkflowLabel{Name: name, Value: value})
+	}
+
+	nextRuntime := body.NextRuntime
+	wf := table.Workflow{
+		Name:                     body.Name,
+		Artifact:                 body.Artifact,
+		Command:                  body.Command,
+		Every:                    every,
+		NextRuntime:              body.NextRuntime,
+		Backfill:                 misfirePolicy == model.MisfireFireAll,
+		Owner:                    body.Owner,
+		IsActive:                 body.IsActive,
+		ScheduleDelayMinutes:     body.ScheduleDelayMinutes,
+		Timezone:                 body.Timezone,
+		ScheduleAnchor:           &nextRuntime,
+		EndTime:                  body.EndTime,
+		MaxRuns:                  body.MaxRuns,
+		MisfirePolicy:            misfirePolicy,
+		MisfireLastN:             body.MisfireLastN,
+		MaxCatchUpMinutes:        body.MaxCatchUpMinutes,
+		OverlapPolicy:            overlapPolicy,
+		DependencyTimeoutMinutes: body.DependencyTimeoutMinutes,
+		Parameters:               body.Parameters,
+		TemplateCommand:          body.TemplateCommand,
+		Team:                     body.Team,
+	}
+	return wf, workflowAssociations{&calendars, &upstreams, &labels}, nil
+}
+
+// restartRunCount adds run_count to the columns written from wf, which has
+// none, if they change the max runs or the start of the schedule of current,
+// or if wf activates current after its max runs were reached. Otherwise the
+// workflow would be deactivated again on the next tick.
+func restartRunCount(current table.Workflow, wf table.Workflow, columns []string) []string {
+	started := slices.Contains(columns, "schedule_anchor") &&
+		(current.ScheduleAnchor == nil || !current.ScheduleAnchor.Equal(*wf.ScheduleAnchor))
+	exhausted := current.MaxRuns > 0 && current.RunCount >= current.MaxRuns
+	activated := slices.Contains(columns, "is_active") && wf.IsActive && !current.IsActive
+	if current.MaxRuns != wf.MaxRuns || started || (activated && exhausted) {
+		return append(columns, "run_count")
+	}
+	return columns
+}
+
+// saveWorkflow writes the columns of wf, bumps its version and records the
+// new definition for action. Without an expected version the workflow is
+// upserted (and undeleted), otherwise it is only updated if still at that
+// version.
+func (ctrl *Control) saveWorkflow(
+	wf table.Workflow,
+	columns []string,
+	version *uint,
+	associations workflowAssociations,
+	action string,
+) (table.Workflow, error) {
+	columns = append([]string{"updated_at"}, columns...)
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if version == nil {
+			// upsert workflow
+			assignments := clause.AssignmentColumns(columns)
+			assignments = append(assignments, clause.Assignment{
+				Column: clause.Column{Name: "version"},
+				Value:  gorm.Expr("workflows.version + 1"),
+			})
+			err := tx.Clauses(
+				clause.OnConflict{
+					Columns:   []clause.Column{{Name: "name"}},
+					DoUpdates: assignments,
+				}).Create(&wf).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(&wf).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		} else {
+			wf.Version = *version + 1
+			result := tx.Model(&table.Workflow{}).
+				Where("name = ? and version = ?", wf.Name, *version).
+				Select(append(columns, "version")).
+				Updates(&wf)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errVersionMismatch
+			}
+		}
+		// the upsert doesn't return the id and version of an existing row
+		if err := tx.Where("name = ?", wf.Name).First(&wf).Error; err != nil {
+			return err
+		}
+		if associations.calendars != nil {
+			if err := tx.Model(&wf).Association("Calendars").Replace(*associations.calendars); err != nil {
+				return err
+			}
+		}
+		if associations.upstreams != nil {
+			if err := tx.Model(&wf).Association("Upstreams").Replace(*associations.upstreams); err != nil {
+				return err
+			}
+		}
+		if associations.labels != nil {
+			if err := tx.Where("workflow_id = ?", wf.ID).Delete(&table.WorkflowLabel{}).Error; err != nil {
+				return err
+			}
+			for _, label := range *associations.labels {
+				label.WorkflowID = wf.ID
+				if err := tx.Create(&label).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return recordVersion(tx, wf, action)
+	})
+	return wf, err
+}
+
+// savedWorkflow writes the response of a failed saveWorkflow, reporting
+// whether it succeeded
+func (ctrl *Control) savedWorkflow(c *gin.Context, name string, err error) bool {
+	if errors.Is(err, errVersionMismatch) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"name": name, "error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"name": name, "error": err.Error()})
+		return false
+	}
+	return true
+}
+
 func (ctrl *Control) deleteWorkflow(c *gin.Context) {
 	var body deleteWorkflowReq
 	if err := c.BindJSON(&body); err != nil {
@@ -117,41 +356,271 @@ func (ctrl *Control) deleteWorkflow(c *gin.Context) {
 		return
 	}
 
-	dbRes := ctrl.db.Where("name = ?", body.Name).Delete(&table.Workflow{})
-	if dbRes.RowsAffected == 0 {
+	var wf table.Workflow
+	if ctrl.db.Where("name = ?", body.Name).Limit(1).Find(&wf).RowsAffected == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"name:": body.Name})
 		return
 	}
-	if dbRes.Error == nil {
+	err := softDeleteWorkflow(ctrl.db, wf)
+	if err == nil {
 		c.JSON(http.StatusOK, gin.H{"name:": body.Name})
 	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"name:": body.Name, "error": dbRes.Error})
+		c.JSON(http.StatusInternalServerError, gin.H{"name:": body.Name, "error": err})
+	}
+}
+
+// softDeleteWorkflow deletes wf, keeping its definition and runs, as a new
+// version
+func softDeleteWorkflow(db *gorm.DB, wf table.Workflow) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&wf).Update("version", gorm.Expr("version + 1")).Error; err != nil {
+			return err
+		}
+		if err := preloadDefinition(tx).First(&wf, wf.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&wf).Error; err != nil {
+			return err
+		}
+		return recordVersion(tx, wf, versionDelete)
+	})
+}
+
+// restoreWorkflow handles POST /v1/workflow/:name/restore, the workflow is
+// back as it was deleted, active or paused, and its leftover locks are
+// released
+func (ctrl *Control) restoreWorkflow(c *gin.Context) {
+	name := c.Param("name")
+	var wf table.Workflow
+	if ctrl.db.Unscoped().Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+	if !wf.DeletedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"name": name, "error": "workflow is not deleted"})
+		return
+	}
+
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&wf).
+			Where("deleted_at IS NOT NULL").
+			Updates(map[string]interface{}{
+				"deleted_at":       nil,
+				"version":          gorm.Expr("version + 1"),
+				"claim_token":      "",
+				"claim_expires_at": nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionMismatch
+		}
+		if err := tx.Where("workflow_id = ?", wf.ID).Delete(&table.WorkflowSchedulerLock{}).Error; err != nil {
+			return err
+		}
+		err := tx.Where("scheduled_id IN (?)", tx.Model(&table.ScheduledWorkflow{}).Select("id").Where("workflow_id = ?", wf.ID)).
+			Delete(&table.WorkflowActivatorLock{}).Error
+		if err != nil {
+			return err
+		}
+		return recordVersion(tx, wf, versionRestore)
+	})
+	if !ctrl.savedWorkflow(c, name, err) {
+		return
+	}
+	fmt.Printf("workflow (name: %s) restored\n", name)
+	ctrl.db.First(&wf, wf.ID)
+	c.Header("ETag", workflowETag(wf))
+	c.IndentedJSON(http.StatusOK, ctrl.reloadWorkflow(wf))
+}
+
+// purgeWorkflows handles POST /v1/workflows/purge
+// Query parameters:
+//   - olderThan: Go duration, purge the workflows deleted for longer than it
+//   - dryRun: only report what would be purged (default: false)
+func (ctrl *Control) purgeWorkflows(c *gin.Context) {
+	olderThan, err := time.ParseDuration(c.Query("olderThan"))
+	if err != nil || olderThan < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_older_than_value",
+			Code:    "400",
+			Message: "olderThan must be a positive duration, e.g. 720h",
+		})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_dry_run_value",
+			Code:    "400",
+			Message: "dryRun must be 'true' or 'false'",
+		})
+		return
+	}
+
+	report, err := purgeWorkflows(ctrl.db, time.Now().Add(-olderThan), dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	fmt.Println(report)
+	c.JSON(http.StatusOK, report)
 }
 
 func (ctrl *Control) getWorkflow(c *gin.Context) {
 	name := c.Param("name")
 	var workflow table.Workflow
-	dbRes := ctrl.db.Model(&table.Workflow{}).
+	dbRes := preloadDefinition(ctrl.db.Model(&table.Workflow{})).
 		Where("name = ?", name).
 		Find(&workflow)
 
 	if dbRes.Error != nil || dbRes.RowsAffected == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
 	} else {
-		resp := putWorkflowReq{
-			Name:                 workflow.Name,
-			Artifact:             workflow.Artifact,
-			Command:              workflow.Command,
-			Every:                workflow.Every.String(),
-			NextRuntime:          workflow.NextRuntime,
-			Backfill:             workflow.Backfill,
-			Owner:                workflow.Owner,
-			IsActive:             workflow.IsActive,
-			ScheduleDelayMinutes: workflow.ScheduleDelayMinutes}
+		c.Header("ETag", workflowETag(workflow))
+		c.IndentedJSON(http.StatusOK, workflowResponse(workflow))
+	}
+}
+
+// preloadDefinition loads the rows linked to the workflow definitions queried
+func preloadDefinition(db *gorm.DB) *gorm.DB {
+	return db.Preload("Calendars").Preload("Upstreams").Preload("Labels")
+}
+
+// workflowResponse converts a workflow row to the shape accepted by
+// putWorkflow, secrets redacted
+func workflowResponse(workflow table.Workflow) getWorkflowResp {
+	req := workflowDefinition(workflow)
+	req.Parameters = workflow.Parameters.Redacted()
+	return getWorkflowResp{
+		putWorkflowReq: req,
+		RunCount:       workflow.RunCount,
+		Paused:         workflow.PausedAt != nil,
+		PausedAt:       workflow.PausedAt,
+		PausedBy:       workflow.PausedBy,
+		PauseReason:    workflow.PauseReason,
+		ResumeAt:       workflow.ResumeAt,
+		DeletedAt:      deletedAt(workflow),
+		ResumedAt:      workflow.ResumedAt,
+		ResumedBy:      workflow.ResumedBy,
+		ResumeReason:   workflow.ResumeReason,
+	}
+}
+
+func deletedAt(workflow table.Workflow) *time.Time {
+	if !workflow.DeletedAt.Valid {
+		return nil
+	}
+	return &workflow.DeletedAt.Time
+}
+
+// workflowDefinition converts a workflow row to the shape accepted by
+// putWorkflow
+func workflowDefinition(workflow table.Workflow) putWorkflowReq {
+	calendars := []string{}
+	for _, cal := range workflow.Calendars {
+		calendars = append(calendars, cal.Name)
+	}
+	dependsOn := []string{}
+	for _, upstream := range workflow.Upstreams {
+		dependsOn = append(dependsOn, upstream.Name)
+	}
+	labels := model.Labels{}
+	for _, label := range workflow.Labels {
+		labels[label.Name] = label.Value
+	}
+	return putWorkflowReq{
+		Name:                     workflow.Name,
+		Artifact:                 workflow.Artifact,
+		Command:                  workflow.Command,
+		Every:                    workflow.Every.String(),
+		NextRuntime:              workflow.NextRuntime,
+		Backfill:                 workflow.Backfill,
+		Owner:                    workflow.Owner,
+		IsActive:                 workflow.IsActive,
+		ScheduleDelayMinutes:     workflow.ScheduleDelayMinutes,
+		Timezone:                 workflow.Timezone,
+		Calendars:                calendars,
+		EndTime:                  workflow.EndTime,
+		MaxRuns:                  workflow.MaxRuns,
+		MisfirePolicy:            string(model.MisfirePolicyOf(workflow.MisfirePolicy, workflow.Backfill)),
+		MisfireLastN:             workflow.MisfireLastN,
+		MaxCatchUpMinutes:        workflow.MaxCatchUpMinutes,
+		OverlapPolicy:            string(workflow.OverlapPolicy),
+		DependsOn:                dependsOn,
+		DependencyTimeoutMinutes: workflow.DependencyTimeoutMinutes,
+		Parameters:               workflow.Parameters,
+		TemplateCommand:          workflow.TemplateCommand,
+		Labels:                   labels,
+		Team:                     workflow.Team,
+	}
+}
+
+// keepSecrets puts back the stored value of the secret parameters sent
+// redacted, as returned by getWorkflow
+func keepSecrets(db *gorm.DB, name string, params model.Parameters) {
+	var wf table.Workflow
+	if db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		return
+	}
+	for paramName, param := range params {
+		stored, ok := wf.Parameters[paramName]
+		if param.Type == model.ParameterSecret && param.Value == model.RedactedValue && ok {
+			param.Value = stored.Value
+			params[paramName] = param
+		}
+	}
+}
 
-		c.IndentedJSON(http.StatusOK, resp)
+// findUpstreams looks up the workflows name depends on, failing if any of
+// them is missing or if one of them already depends on name
+func findUpstreams(db *gorm.DB, name string, names []string) ([]table.Workflow, error) {
+	upstreams := []table.Workflow{}
+	if len(names) == 0 {
+		return upstreams, nil
+	}
+	if err := db.Where("name IN ?", names).Find(&upstreams).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	ids := []uint{}
+	for _, upstream := range upstreams {
+		if upstream.Name == name {
+			return nil, fmt.Errorf("Workflow %q can't depend on itself", name)
+		}
+		found[upstream.Name] = true
+		ids = append(ids, upstream.ID)
+	}
+	for _, upstreamName := range names {
+		if !found[upstreamName] {
+			return nil, fmt.Errorf("Workflow %q not found", upstreamName)
+		}
+	}
+
+	var wf table.Workflow
+	if db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		// nothing depends on a new workflow yet
+		return upstreams, nil
+	}
+	seen := make(map[uint]bool)
+	for len(ids) > 0 {
+		var deps []table.WorkflowDependency
+		if err := db.Where("workflow_id IN ?", ids).Find(&deps).Error; err != nil {
+			return nil, err
+		}
+		ids = []uint{}
+		for _, dep := range deps {
+			if dep.UpstreamID == wf.ID {
+				return nil, fmt.Errorf("Workflow %q would depend on itself through its upstreams", name)
+			}
+			if !seen[dep.UpstreamID] {
+				seen[dep.UpstreamID] = true
+				ids = append(ids, dep.UpstreamID)
+			}
+		}
 	}
+	return upstreams, nil
 }
 
 // getWorkflows handles GET /v1/workflows
@@ -161,22 +630,37 @@ func (ctrl *Control) getWorkflow(c *gin.Context) {
 //   - page: page number (default: 1)
 //   - limit: items per page (default: 50)
 //   - like: name filter pattern
+//   - deleted: list the deleted workflows instead (default: false)
+//   - team: owning team
+//   - selector: label selector, e.g. "env=prod,tier!=batch"
+//   - isActive: true or false
+//   - everyUnit: minute, hour, day, week, month, year or cron
+//   - owner: exact owner
+//   - artifactPrefix: artifact starting with it
+//   - nextRuntimeBefore, nextRuntimeAfter: RFC 3339 times, exclusive
+//   - lastRunStatus: comma separated statuses of the latest scheduled run
+//   - cursor: nextCursor of the previous page, empty for the first one, instead of page
 func (ctrl *Control) getWorkflows(c *gin.Context) {
 
 	start := time.Now()
-	// Get query parameters for ordering
-	orderBy := c.DefaultQuery("orderBy", "name")
-	orderDir := c.DefaultQuery("orderDir", "asc")
-
-	// Get pagination parameters
-	pageStr := c.DefaultQuery("page", "1")
-	limitStr := c.DefaultQuery("limit", "50")
 
 	// Get filtering parameters
 	likePattern := c.Query("like")
+	deleted, err := strconv.ParseBool(c.DefaultQuery("deleted", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_deleted_value",
+			Code:    "400",
+			Message: "deleted must be 'true' or 'false'",
+		})
+		return
+	}
 
 	// Build the query
 	query := ctrl.db.Model(&table.Workflow{})
+	if deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
 
 	// Apply name filtering if like pattern is provided
 	if likePattern != "" {
@@ -193,38 +677,23 @@ func (ctrl *Control) getWorkflows(c *gin.Context) {
 		query = query.Where("name LIKE ?", "%"+likePattern+"%")
 	}
 
-	// Create a new session for the count query
-	var total int64
-	countQuery := query.Session(&gorm.Session{})
-	countQuery.Count(&total)
-
-	// Validate order direction
-	if orderDir != "asc" && orderDir != "desc" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_order_direction",
-			Code:    "400",
-			Message: "orderDir must be 'asc' or 'desc'",
-		})
-		return
+	if team := c.Query("team"); team != "" {
+		query = query.Where("team = ?", team)
 	}
-
-	// Parse pagination parameters
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_page_value",
-			Code:    "400",
-			Message: "page must be a positive integer",
-		})
-		return
+	if selectorStr := c.Query("selector"); selectorStr != "" {
+		selector, err := model.ParseSelector(selectorStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_selector",
+				Code:    "400",
+				Message: err.Error(),
+			})
+			return
+		}
+		query = applySelector(query, selector)
 	}
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_limit_value",
-			Code:    "400",
-			Message: "limit must be a positive integer"})
+	query, ok := filterWorkflows(c, query)
+	if !ok {
 		return
 	}
 
@@ -238,29 +707,50 @@ func (ctrl *Control) getWorkflows(c *gin.Context) {
 		"artifact":             "artifact",
 		"command":              "command",
 		"backfill":             "backfill",
+		"timezone":             "timezone",
+		"endTime":              "end_time",
+		"maxRuns":              "max_runs",
+		"runCount":             "run_count",
+		"misfirePolicy":        "misfire_policy",
+		"overlapPolicy":        "overlap_policy",
+		"deletedAt":            "deleted_at",
+		"team":                 "team",
 	}
 
-	// Get the database column name
-	dbColumn, ok := columnMap[orderBy]
+	order, ok := parseOrder(c, "name", "asc", columnMap)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
 	if !ok {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_order_by_field",
-			Code:    "400",
-			Message: fmt.Sprintf("Invalid orderBy field: %s", orderBy)})
 		return
 	}
+	orderBy := c.DefaultQuery("orderBy", "name")
+	orderDir := c.DefaultQuery("orderDir", "asc")
 
-	// Calculate pagination
-	offset := (page - 1) * limit
+	// cursor pagination skips the count and offset, that get slow on large fleets
+	cursor, cursorPaging := c.GetQuery("cursor")
+	var total int64
+	if cursorPaging {
+		if query, ok = applyCursor(c, query, cursor, orderBy, orderDir); !ok {
+			return
+		}
+	} else {
+		// Create a new session for the count query
+		countQuery := query.Session(&gorm.Session{})
+		countQuery.Count(&total)
 
-	// Apply ordering
-	query = query.Order(fmt.Sprintf("%s %s", dbColumn, orderDir))
+		// Apply pagination
+		query = query.Offset((page - 1) * limit)
+	}
 
-	// Apply pagination
-	query = query.Offset(offset).Limit(limit)
+	// Apply ordering, the id breaks ties for stable pages
+	query = query.Order(order).Order("id " + orderDir).Limit(limit)
 
 	// handle soft deletes
-	query = query.Unscoped().Where("deleted_at IS NULL")
+	if !deleted {
+		query = query.Unscoped().Where("deleted_at IS NULL")
+	}
 
 	// Apply context timeout
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
@@ -269,7 +759,7 @@ func (ctrl *Control) getWorkflows(c *gin.Context) {
 
 	// Execute query
 	var workflows []table.Workflow
-	result := query.Find(&workflows)
+	result := preloadDefinition(query).Find(&workflows)
 
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
@@ -277,36 +767,91 @@ func (ctrl *Control) getWorkflows(c *gin.Context) {
 	}
 
 	// Convert to response format
-	var response []putWorkflowReq
+	var response []getWorkflowResp
 	for _, workflow := range workflows {
-		response = append(response, putWorkflowReq{
-			Name:                 workflow.Name,
-			Artifact:             workflow.Artifact,
-			Command:              workflow.Command,
-			Every:                workflow.Every.String(),
-			NextRuntime:          workflow.NextRuntime,
-			Backfill:             workflow.Backfill,
-			Owner:                workflow.Owner,
-			IsActive:             workflow.IsActive,
-			ScheduleDelayMinutes: workflow.ScheduleDelayMinutes,
-		})
+		response = append(response, workflowResponse(workflow))
 	}
 
 	// Return response with pagination metadata
+	pagination := gin.H{"limit": limit}
+	if !cursorPaging {
+		pagination = paginationResponse(total, page, limit)
+	}
+	if cursorOrders[orderBy] {
+		pagination["nextCursor"] = nil
+		if len(workflows) == limit {
+			pagination["nextCursor"] = newWorkflowCursor(orderBy, orderDir, workflows[len(workflows)-1])
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"data": response,
-		"pagination": gin.H{
-			"total":      total,
-			"page":       page,
-			"limit":      limit,
-			"totalPages": int(math.Ceil(float64(total) / float64(limit))),
-		},
+		"data":       response,
+		"pagination": pagination,
 	})
 
 	metrics.UpdateHistogram("http_request_duration_seconds", time.Since(start), map[string]string{"route": "get_workflows"})
 	metrics.IncrementCounter("http_requests_total", map[string]string{"route": "get_workflows"})
 }
 
+// parseOrder validates the orderBy and orderDir query parameters and returns
+// the matching ORDER BY clause, orderBy must be one of the columnMap keys
+func parseOrder(c *gin.Context, defaultOrderBy string, defaultOrderDir string, columnMap map[string]string) (string, bool) {
+	orderBy := c.DefaultQuery("orderBy", defaultOrderBy)
+	orderDir := c.DefaultQuery("orderDir", defaultOrderDir)
+
+	// Validate order direction
+	if orderDir != "asc" && orderDir != "desc" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_order_direction",
+			Code:    "400",
+			Message: "orderDir must be 'asc' or 'desc'",
+		})
+		return "", false
+	}
+
+	// Get the database column name
+	dbColumn, ok := columnMap[orderBy]
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_order_by_field",
+			Code:    "400",
+			Message: fmt.Sprintf("Invalid orderBy field: %s", orderBy)})
+		return "", false
+	}
+	return fmt.Sprintf("%s %s", dbColumn, orderDir), true
+}
+
+// parsePagination validates the page and limit query parameters
+func parsePagination(c *gin.Context) (int, int, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_page_value",
+			Code:    "400",
+			Message: "page must be a positive integer",
+		})
+		return 0, 0, false
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_limit_value",
+			Code:    "400",
+			Message: "limit must be a positive integer"})
+		return 0, 0, false
+	}
+	return page, limit, true
+}
+
+func paginationResponse(total int64, page int, limit int) gin.H {
+	return gin.H{
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	}
+}
+
 func APIKeyAuth(key string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		k := c.GetHeader("x-api-key")
@@ -345,7 +890,37 @@ func handleAuth(v *gin.RouterGroup, ctrl *Control) {
 	}
 }
 
-func (ctrl *Control) Run() {
+// routes registers the handlers of the control API
+func (ctrl *Control) routes(v1 *gin.RouterGroup) {
+	v1.PUT("/workflow", ctrl.putWorkflow)
+	v1.DELETE("/workflow", ctrl.deleteWorkflow)
+	v1.GET("/workflow/:name", ctrl.getWorkflow)
+	v1.PATCH("/workflow/:name", ctrl.patchWorkflow)
+	v1.GET("/workflow/:name/versions", ctrl.getWorkflowVersions)
+	v1.POST("/workflow/:name/rollback", ctrl.rollbackWorkflow)
+	v1.POST("/workflow/:name/restore", ctrl.restoreWorkflow)
+	v1.GET("/workflows", ctrl.getWorkflows)
+	v1.POST("/workflows/purge", ctrl.purgeWorkflows)
+	v1.POST("/workflows/pause", ctrl.pauseWorkflows)
+	v1.POST("/workflows/resume", ctrl.resumeWorkflows)
+	v1.DELETE("/workflows", ctrl.deleteWorkflows)
+	v1.GET("/workflow/:name/runs", ctrl.getWorkflowRuns)
+	v1.GET("/runs/:id", ctrl.getRun)
+	v1.POST("/workflow/:name/trigger", ctrl.triggerWorkflow)
+	v1.POST("/workflow/:name/pause", ctrl.pauseWorkflow)
+	v1.POST("/workflow/:name/resume", ctrl.resumeWorkflow)
+	v1.POST("/workflow/:name/backfill", ctrl.postBackfill)
+	v1.GET("/backfill/:id", ctrl.getBackfill)
+	v1.POST("/backfill/:id/cancel", ctrl.cancelBackfill)
+	v1.PUT("/calendar", ctrl.putCalendar)
+	v1.DELETE("/calendar", ctrl.deleteCalendar)
+	v1.GET("/calendar/:name", ctrl.getCalendar)
+	v1.GET("/calendars", ctrl.getCalendars)
+}
+
+// Run serves the control API until ctx is done, then shuts the server down
+// gracefully, the requests in flight having until shutdownTimeout to finish
+func (ctrl *Control) Run(ctx context.Context, shutdownTimeout time.Duration) {
 	r := gin.Default()
 
 	if err := r.SetTrustedProxies(ctrl.trustedProxies); err != nil {
@@ -357,12 +932,7 @@ func (ctrl *Control) Run() {
 
 	v1 := r.Group("/v1")
 	handleAuth(v1, ctrl)
-	{
-		v1.PUT("/workflow", ctrl.putWorkflow)
-		v1.DELETE("/workflow", ctrl.deleteWorkflow)
-		v1.GET("/workflow/:name", ctrl.getWorkflow)
-		v1.GET("/workflows", ctrl.getWorkflows)
-	}
+	ctrl.routes(v1)
 
 	r.GET("__status", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -372,7 +942,12 @@ func (ctrl *Control) Run() {
 	})
 	r.GET("__metrics", metrics.GinMetricsHandler)
 
-	if err := r.Run(ctrl.address); err != nil {
+	fmt.Printf("Control listening on %s\n", ctrl.address)
+	server := &http.Server{Addr: ctrl.address, Handler: r}
+	if err := serve(ctx, server, shutdownTimeout); err != nil {
 		log.Fatal(err)
 	}
+	// locks taken by triggers still running past the timeout
+	ctrl.scheduler.abandonClaims()
+	fmt.Println("Control stopped")
 }
@@ -0,0 +1,191 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+type postBackfillReq struct {
+	From           time.Time `json:"from" binding:"required"`
+	To             time.Time `json:"to" binding:"required"` // exclusive
+	MaxParallelism uint      `json:"maxParallelism"`        // default 1 if absent
+}
+
+type backfillResp struct {
+	ID             uint             `json:"id"`
+	WorkflowName   string           `json:"workflowName"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	MaxParallelism uint             `json:"maxParallelism"`
+	Status         string           `json:"status"` // running, completed, canceled or failed
+	Runs           map[string]int64 `json:"runs"`   // number of runs by status
+	Reason         string           `json:"reason,omitempty"`
+}
+
+// postBackfill handles POST /v1/workflow/:name/backfill
+func (ctrl *Control) postBackfill(c *gin.Context) {
+	name := c.Param("name")
+	var body postBackfillReq
+	if err := c.BindJSON(&body); err != nil {
+		// bad request
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !body.To.After(body.From) {
+		c.JSON(http.StatusBadRequest, "to must be after from")
+		return
+	}
+	if body.To.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, "to must not be in the future")
+		return
+	}
+	if body.MaxParallelism == 0 {
+		body.MaxParallelism = 1
+	}
+
+	var wf table.Workflow
+	if ctrl.db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+	slots, err := backfillSlots(wf, body.From, body.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(slots) == 0 {
+		c.JSON(http.StatusBadRequest, "no slot between from and to")
+		return
+	}
+
+	bf := table.Backfill{
+		WorkflowID:     wf.ID,
+		FromTime:       body.From,
+		ToTime:         body.To,
+		MaxParallelism: body.MaxParallelism,
+	}
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&bf).Error; err != nil {
+			return err
+		}
+		runs := []table.ScheduledWorkflow{}
+		for _, slot := range slots {
+			runs = append(runs, table.ScheduledWorkflow{
+				WorkflowID:         wf.ID,
+				StartTime:          time.Now(),
+				ScheduledStartTime: slot,
+				Status:             Queued.ToString(),
+				TriggerType:        TriggerBackfill,
+				BackfillID:         &bf.ID,
+			})
+		}
+		return tx.CreateInBatches(&runs, 500).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"name": name, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ctrl.backfillResponse(bf, wf))
+}
+
+// getBackfill handles GET /v1/backfill/:id
+func (ctrl *Control) getBackfill(c *gin.Context) {
+	bf, ok := ctrl.findBackfill(c)
+	if !ok {
+		return
+	}
+	var wf table.Workflow
+	ctrl.db.Unscoped().Limit(1).Find(&wf, bf.WorkflowID)
+	c.IndentedJSON(http.StatusOK, ctrl.backfillResponse(bf, wf))
+}
+
+// cancelBackfill handles POST /v1/backfill/:id/cancel
+func (ctrl *Control) cancelBackfill(c *gin.Context) {
+	bf, ok := ctrl.findBackfill(c)
+	if !ok {
+		return
+	}
+	if bf.CanceledAt == nil {
+		err := ctrl.scheduler.cancelBackfill(ctrl.db, bf)
+		if errors.Is(err, ErrWorkflowLocked) {
+			c.JSON(http.StatusConflict, gin.H{"id": bf.ID, "error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"id": bf.ID, "error": err.Error()})
+			return
+		}
+		ctrl.db.First(&bf, bf.ID)
+	}
+	var wf table.Workflow
+	ctrl.db.Unscoped().Limit(1).Find(&wf, bf.WorkflowID)
+	c.JSON(http.StatusOK, ctrl.backfillResponse(bf, wf))
+}
+
+func (ctrl *Control) findBackfill(c *gin.Context) (table.Backfill, bool) {
+	var bf table.Backfill
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_backfill_id",
+			Code:    "400",
+			Message: "backfill id must be a positive integer",
+		})
+		return bf, false
+	}
+	if ctrl.db.Limit(1).Find(&bf, id).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Backfill not found:": fmt.Sprintf("id=%d", id)})
+		return bf, false
+	}
+	return bf, true
+}
+
+func (ctrl *Control) backfillResponse(bf table.Backfill, wf table.Workflow) backfillResp {
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+	ctrl.db.Model(&table.ScheduledWorkflow{}).
+		Select("status, count(*) as count").
+		Where("backfill_id = ?", bf.ID).
+		Group("status").
+		Scan(&counts)
+
+	status := "completed"
+	runs := make(map[string]int64)
+	for _, count := range counts {
+		runs[count.Status] = count.Count
+		switch count.Status {
+		case Queued.ToString(), Created.ToString(), Activated.ToString():
+			status = "running"
+		}
+	}
+	if bf.CanceledAt != nil {
+		status = "canceled"
+	} else if bf.FailedAt != nil {
+		status = "failed"
+	}
+	return backfillResp{
+		ID:             bf.ID,
+		WorkflowName:   wf.Name,
+		From:           bf.FromTime,
+		To:             bf.ToTime,
+		MaxParallelism: bf.MaxParallelism,
+		Status:         status,
+		Runs:           runs,
+		Reason:         bf.FailureReason,
+	}
+}
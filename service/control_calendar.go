@@ -0,0 +1,165 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+type putCalendarReq struct {
+	Name          string              `json:"name" binding:"required"`
+	Timezone      string              `json:"timezone"` // IANA name, default UTC if absent
+	Action        string              `json:"action"`   // skip or defer, default skip if absent
+	DateRanges    model.DateRanges    `json:"dateRanges"`
+	WeeklyWindows model.WeeklyWindows `json:"weeklyWindows"`
+}
+
+type deleteCalendarReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func calendarResponse(cal table.Calendar) putCalendarReq {
+	return putCalendarReq{
+		Name:          cal.Name,
+		Timezone:      cal.Timezone,
+		Action:        string(cal.Action),
+		DateRanges:    cal.DateRanges,
+		WeeklyWindows: cal.WeeklyWindows,
+	}
+}
+
+func (ctrl *Control) putCalendar(c *gin.Context) {
+	var body putCalendarReq
+	if err := c.BindJSON(&body); err != nil {
+		// bad request
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	action, err := model.ParseBlackoutAction(body.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Timezone == "" {
+		body.Timezone = model.DefaultTimezone
+	}
+	if _, err := model.LoadTimezone(body.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, r := range body.DateRanges {
+		if err := r.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	for _, w := range body.WeeklyWindows {
+		if err := w.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	cal := table.Calendar{
+		Name:          body.Name,
+		Timezone:      body.Timezone,
+		Action:        action,
+		DateRanges:    body.DateRanges,
+		WeeklyWindows: body.WeeklyWindows,
+	}
+	// upsert calendar
+	ctrl.db.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at", "timezone", "action", "date_ranges", "weekly_windows"}),
+		}).Create(&cal)
+	ctrl.db.Unscoped().Model(&cal).Update("deleted_at", nil)
+	c.JSON(http.StatusOK, "OK")
+}
+
+func (ctrl *Control) deleteCalendar(c *gin.Context) {
+	var body deleteCalendarReq
+	if err := c.BindJSON(&body); err != nil {
+		// bad request
+		c.JSON(http.StatusBadRequest, gin.H{"message": "could not parse body"})
+		return
+	}
+
+	var cal table.Calendar
+	if ctrl.db.Where("name = ?", body.Name).Limit(1).Find(&cal).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"name:": body.Name})
+		return
+	}
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("calendar_id = ?", cal.ID).Delete(&table.WorkflowCalendar{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&cal).Error
+	})
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"name:": body.Name})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"name:": body.Name, "error": err})
+	}
+}
+
+func (ctrl *Control) getCalendar(c *gin.Context) {
+	name := c.Param("name")
+	var cal table.Calendar
+	dbRes := ctrl.db.Where("name = ?", name).Find(&cal)
+
+	if dbRes.Error != nil || dbRes.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Calendar not found:": fmt.Sprintf("name=%s", name)})
+	} else {
+		c.IndentedJSON(http.StatusOK, calendarResponse(cal))
+	}
+}
+
+// getCalendars handles GET /v1/calendars, calendars are few so they are not
+// paginated
+func (ctrl *Control) getCalendars(c *gin.Context) {
+	var calendars []table.Calendar
+	if err := ctrl.db.Order("name").Find(&calendars).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := []putCalendarReq{}
+	for _, cal := range calendars {
+		response = append(response, calendarResponse(cal))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// findCalendars looks up calendars by name, failing if any of them is missing
+func findCalendars(db *gorm.DB, names []string) ([]table.Calendar, error) {
+	calendars := []table.Calendar{}
+	if len(names) == 0 {
+		return calendars, nil
+	}
+	if err := db.Where("name IN ?", names).Find(&calendars).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, cal := range calendars {
+		found[cal.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, fmt.Errorf("Calendar %q not found", name)
+		}
+	}
+	return calendars, nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+// everyUnitCron selects the workflows scheduled by a cron expression
+const everyUnitCron = "cron"
+
+// lastRunStatus is the status of the latest scheduled run of a workflow
+const lastRunStatus = `(SELECT scheduled_workflows.status FROM scheduled_workflows
+	WHERE scheduled_workflows.workflow_id = workflows.id AND scheduled_workflows.deleted_at IS NULL
+	ORDER BY scheduled_workflows.scheduled_start_time DESC, scheduled_workflows.id DESC LIMIT 1)`
+
+// filterWorkflows applies the filter query parameters of getWorkflows,
+// writing the error response if one of them is invalid
+func filterWorkflows(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	if value := c.Query("isActive"); value != "" {
+		isActive, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_is_active_value",
+				Code:    "400",
+				Message: "isActive must be 'true' or 'false'",
+			})
+			return nil, false
+		}
+		query = query.Where("is_active = ?", isActive)
+	}
+
+	if unit := c.Query("everyUnit"); unit != "" {
+		if unit == everyUnitCron {
+			query = query.Where("every NOT LIKE ?", "%.%")
+		} else if _, ok := model.EveryUnits[model.EveryUnit(unit)]; ok {
+			query = query.Where("every LIKE ?", "%."+unit)
+		} else {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_every_unit",
+				Code:    "400",
+				Message: "everyUnit must be one of minute, hour, day, week, month, year or cron",
+			})
+			return nil, false
+		}
+	}
+
+	if owner := c.Query("owner"); owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+
+	if prefix := c.Query("artifactPrefix"); prefix != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+		query = query.Where(`artifact LIKE ? ESCAPE '\'`, escaped+"%")
+	}
+
+	for param, condition := range map[string]string{
+		"nextRuntimeBefore": "next_runtime < ?",
+		"nextRuntimeAfter":  "next_runtime > ?",
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   fmt.Sprintf("invalid_%s_value", param),
+				Code:    "400",
+				Message: fmt.Sprintf("%s must be an RFC 3339 time", param),
+			})
+			return nil, false
+		}
+		query = query.Where(condition, t)
+	}
+
+	if statusStr := c.Query("lastRunStatus"); statusStr != "" {
+		statuses := strings.Split(statusStr, ",")
+		for _, status := range statuses {
+			if !validScheduleStatus(status) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "invalid_last_run_status",
+					Code:    "400",
+					Message: fmt.Sprintf("Invalid status: %s", status),
+				})
+				return nil, false
+			}
+		}
+		query = query.Where(lastRunStatus+" IN ?", statuses)
+	}
+	return query, true
+}
+
+// workflowCursor is the position after the last workflow of a page, for the
+// order of the request it was returned by
+type workflowCursor struct {
+	OrderBy     string    `json:"orderBy"`
+	OrderDir    string    `json:"orderDir"`
+	Name        string    `json:"name"`
+	NextRuntime time.Time `json:"nextRuntime"`
+	ID          uint      `json:"id"`
+}
+
+// cursorOrders are the orderBy fields cursor pagination supports
+var cursorOrders = map[string]bool{"name": true, "nextRuntime": true}
+
+func newWorkflowCursor(orderBy string, orderDir string, wf table.Workflow) string {
+	cursor, _ := json.Marshal(workflowCursor{
+		OrderBy:     orderBy,
+		OrderDir:    orderDir,
+		Name:        wf.Name,
+		NextRuntime: wf.NextRuntime,
+		ID:          wf.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(cursor)
+}
+
+// applyCursor keeps the workflows of query after cursor, an empty cursor
+// starts from the first one, writing the error response if it is invalid
+func applyCursor(c *gin.Context, query *gorm.DB, cursorStr string, orderBy string, orderDir string) (*gorm.DB, bool) {
+	invalid := func(message string) (*gorm.DB, bool) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_cursor",
+			Code:    "400",
+			Message: message,
+		})
+		return nil, false
+	}
+	if !cursorOrders[orderBy] {
+		return invalid("cursor pagination only supports orderBy name or nextRuntime")
+	}
+	if _, ok := c.GetQuery("page"); ok {
+		return invalid("cursor and page can't be used together")
+	}
+	if cursorStr == "" {
+		return query, true
+	}
+
+	var cursor workflowCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursorStr)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return invalid("cursor is not one returned by a previous page")
+	}
+	if cursor.OrderBy != orderBy || cursor.OrderDir != orderDir {
+		return invalid("cursor was returned for another orderBy or orderDir")
+	}
+
+	op := ">"
+	if orderDir == "desc" {
+		op = "<"
+	}
+	if orderBy == "name" {
+		return query.Where("name "+op+" ?", cursor.Name), true
+	}
+	return query.Where(
+		fmt.Sprintf("(next_runtime %s ? OR (next_runtime = ? AND id %s ?))", op, op),
+		cursor.NextRuntime, cursor.NextRuntime, cursor.ID,
+	), true
+}
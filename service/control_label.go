@@ -0,0 +1,157 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+// bulkResp lists the workflows a bulk operation was applied to, and the ones
+// it failed for
+type bulkResp struct {
+	Selector  string            `json:"selector"`
+	Workflows []string          `json:"workflows"`
+	Errors    map[string]string `json:"errors"`
+}
+
+const labelExists = "EXISTS (SELECT 1 FROM workflow_labels WHERE workflow_labels.workflow_id = workflows.id AND workflow_labels.name = ?"
+
+// applySelector keeps the workflows of query matching every requirement of
+// selector
+func applySelector(query *gorm.DB, selector model.Selector) *gorm.DB {
+	for _, req := range selector {
+		switch req.Operator {
+		case model.SelectorEquals:
+			query = query.Where(labelExists+" AND workflow_labels.value = ?)", req.Key, req.Values[0])
+		case model.SelectorNotEquals:
+			query = query.Where("NOT "+labelExists+" AND workflow_labels.value = ?)", req.Key, req.Values[0])
+		case model.SelectorIn:
+			query = query.Where(labelExists+" AND workflow_labels.value IN ?)", req.Key, req.Values)
+		case model.SelectorNotIn:
+			query = query.Where("NOT "+labelExists+" AND workflow_labels.value IN ?)", req.Key, req.Values)
+		case model.SelectorExists:
+			query = query.Where(labelExists+")", req.Key)
+		case model.SelectorDoesNotExist:
+			query = query.Where("NOT "+labelExists+")", req.Key)
+		}
+	}
+	return query
+}
+
+// selectWorkflows finds the workflows matching the required selector query
+// parameter, writing the error response if it is missing or invalid
+func (ctrl *Control) selectWorkflows(c *gin.Context) ([]table.Workflow, bool) {
+	selectorStr := c.Query("selector")
+	if selectorStr == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "missing_selector",
+			Code:    "400",
+			Message: "selector is required",
+		})
+		return nil, false
+	}
+	selector, err := model.ParseSelector(selectorStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_selector",
+			Code:    "400",
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+
+	var workflows []table.Workflow
+	result := applySelector(ctrl.db.Model(&table.Workflow{}), selector).Order("name").Find(&workflows)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return nil, false
+	}
+	return workflows, true
+}
+
+// applyBulk runs apply on every workflow selected, collecting the errors
+func (ctrl *Control) applyBulk(c *gin.Context, workflows []table.Workflow, apply func(table.Workflow) error) {
+	response := bulkResp{
+		Selector:  c.Query("selector"),
+		Workflows: []string{},
+		Errors:    map[string]string{},
+	}
+	for _, wf := range workflows {
+		if err := apply(wf); err != nil {
+			fmt.Printf("[error] bulk operation on workflow (name: %s): %v\n", wf.Name, err)
+			response.Errors[wf.Name] = err.Error()
+			continue
+		}
+		response.Workflows = append(response.Workflows, wf.Name)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// pauseWorkflows handles POST /v1/workflows/pause?selector=...
+func (ctrl *Control) pauseWorkflows(c *gin.Context) {
+	var body pauseWorkflowReq
+	if err := c.BindJSON(&body); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.ResumeAt != nil && !body.ResumeAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, "resumeAt must be in the future")
+		return
+	}
+	workflows, ok := ctrl.selectWorkflows(c)
+	if !ok {
+		return
+	}
+	ctrl.applyBulk(c, workflows, func(wf table.Workflow) error {
+		_, err := ctrl.scheduler.pauseWorkflow(ctrl.db, wf, workflowPause{
+			Actor:         body.Actor,
+			Reason:        body.Reason,
+			ResumeAt:      body.ResumeAt,
+			CancelCreated: body.CancelCreated,
+		})
+		return err
+	})
+}
+
+// resumeWorkflows handles POST /v1/workflows/resume?selector=...
+func (ctrl *Control) resumeWorkflows(c *gin.Context) {
+	var body resumeWorkflowReq
+	if err := c.BindJSON(&body); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	workflows, ok := ctrl.selectWorkflows(c)
+	if !ok {
+		return
+	}
+	ctrl.applyBulk(c, workflows, func(wf table.Workflow) error {
+		if err := resumeWorkflow(ctrl.db, wf, workflowResume{Actor: body.Actor, Reason: body.Reason}); err != nil {
+			return err
+		}
+		fmt.Printf("workflow (name: %s) resumed by %s: %s\n", wf.Name, body.Actor, body.Reason)
+		return nil
+	})
+}
+
+// deleteWorkflows handles DELETE /v1/workflows?selector=...
+func (ctrl *Control) deleteWorkflows(c *gin.Context) {
+	workflows, ok := ctrl.selectWorkflows(c)
+	if !ok {
+		return
+	}
+	ctrl.applyBulk(c, workflows, func(wf table.Workflow) error {
+		return softDeleteWorkflow(ctrl.db, wf)
+	})
+}
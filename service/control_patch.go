@@ -0,0 +1,191 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+var errVersionMismatch = errors.New("workflow was modified, get it again")
+
+// patchColumns are the columns set from each field of a workflow merge patch
+var patchColumns = map[string][]string{
+	"artifact":                 {"artifact"},
+	"command":                  {"command"},
+	"every":                    {"every"},
+	"nextRuntime":              {"next_runtime", "schedule_anchor"},
+	"backfill":                 {"backfill", "misfire_policy"},
+	"owner":                    {"owner"},
+	"isActive":                 {"is_active"},
+	"scheduleDelayMinutes":     {"schedule_delay_minutes"},
+	"timezone":                 {"timezone"},
+	"endTime":                  {"end_time"},
+	"maxRuns":                  {"max_runs"},
+	"misfirePolicy":            {"misfire_policy", "backfill"},
+	"misfireLastN":             {"misfire_last_n"},
+	"maxCatchUpMinutes":        {"max_catch_up_minutes"},
+	"overlapPolicy":            {"overlap_policy"},
+	"dependencyTimeoutMinutes": {"dependency_timeout_minutes"},
+	"parameters":               {"parameters"},
+	"templateCommand":          {"template_command"},
+	"team":                     {"team"},
+}
+
+// patchWorkflow handles PATCH /v1/workflow/:name, the body is a JSON merge
+// patch (RFC 7386) of the workflow as returned by getWorkflow. Only the
+// fields in the patch are written, the workflow must not have changed since
+// it was read.
+func (ctrl *Control) patchWorkflow(c *gin.Context) {
+	name := c.Param("name")
+	raw, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, "the body must be a JSON object")
+		return
+	}
+	if patchName, ok := patch["name"]; ok && patchName != name {
+		c.JSON(http.StatusBadRequest, "name can't be patched")
+		return
+	}
+	version, ok := ctrl.ifMatchVersion(c, name)
+	if !ok {
+		return
+	}
+
+	var current table.Workflow
+	if preloadDefinition(ctrl.db).Where("name = ?", name).Limit(1).Find(&current).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+	if version != nil && *version != current.Version {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"name": name, "error": errVersionMismatch.Error()})
+		return
+	}
+
+	var body putWorkflowReq
+	if err := applyMergePatch(workflowResponse(current).putWorkflowReq, patch, &body); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	wf, associations, err := ctrl.workflowFromReq(body)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	columns := []string{}
+	for field := range patch {
+		columns = append(columns, patchColumns[field]...)
+	}
+	if _, ok := patch["isActive"]; ok && body.IsActive {
+		// activating the workflow ends its pause
+		columns = append(columns, pauseColumns...)
+	}
+	columns = restartRunCount(current, wf, columns)
+	if _, ok := patch["calendars"]; !ok {
+		associations.calendars = nil
+	}
+	if _, ok := patch["dependsOn"]; !ok {
+		associations.upstreams = nil
+	}
+	if _, ok := patch["labels"]; !ok {
+		associations.labels = nil
+	}
+	wf, err = ctrl.saveWorkflow(wf, columns, &current.Version, associations, versionPatch)
+	if !ctrl.savedWorkflow(c, name, err) {
+		return
+	}
+	c.Header("ETag", workflowETag(wf))
+	c.IndentedJSON(http.StatusOK, ctrl.reloadWorkflow(wf))
+}
+
+// applyMergePatch merges patch into the JSON of current and decodes the
+// result into patched, checking the required fields are still there
+func applyMergePatch(current putWorkflowReq, patch map[string]interface{}, patched *putWorkflowReq) error {
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var target map[string]interface{}
+	if err := json.Unmarshal(raw, &target); err != nil {
+		return err
+	}
+	raw, err = json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, patched); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(patched)
+}
+
+// mergePatch applies an RFC 7386 merge patch to target: objects are merged
+// recursively, null removes a member and anything else replaces it
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+func workflowETag(wf table.Workflow) string {
+	return fmt.Sprintf("%q", strconv.FormatUint(uint64(wf.Version), 10))
+}
+
+// ifMatchVersion returns the workflow version required by the If-Match
+// header, nil if there is none. A tag not matching the workflow fails the
+// request with 412.
+func (ctrl *Control) ifMatchVersion(c *gin.Context, name string) (*uint, bool) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" {
+		return nil, true
+	}
+	var wf table.Workflow
+	if ctrl.db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"name": name, "error": "workflow not found"})
+		return nil, false
+	}
+	if ifMatch == "*" {
+		return &wf.Version, true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == workflowETag(wf) {
+			return &wf.Version, true
+		}
+	}
+	c.JSON(http.StatusPreconditionFailed, gin.H{"name": name, "error": errVersionMismatch.Error()})
+	return nil, false
+}
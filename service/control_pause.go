@@ -0,0 +1,105 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+type pauseWorkflowReq struct {
+	Actor         string     `json:"actor" binding:"required"`
+	Reason        string     `json:"reason"`
+	ResumeAt      *time.Time `json:"resumeAt"`      // paused until resumed if absent
+	CancelCreated bool       `json:"cancelCreated"` // delete the runs not activated yet
+}
+
+type resumeWorkflowReq struct {
+	Actor  string `json:"actor" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// pauseWorkflow handles POST /v1/workflow/:name/pause
+func (ctrl *Control) pauseWorkflow(c *gin.Context) {
+	name := c.Param("name")
+	var body pauseWorkflowReq
+	if err := c.BindJSON(&body); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.ResumeAt != nil && !body.ResumeAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, "resumeAt must be in the future")
+		return
+	}
+
+	var wf table.Workflow
+	if ctrl.db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+
+	runs, err := ctrl.scheduler.pauseWorkflow(ctrl.db, wf, workflowPause{
+		Actor:         body.Actor,
+		Reason:        body.Reason,
+		ResumeAt:      body.ResumeAt,
+		CancelCreated: body.CancelCreated,
+	})
+	if errors.Is(err, ErrWorkflowLocked) {
+		c.JSON(http.StatusConflict, gin.H{"name": name, "error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"name": name, "error": err.Error()})
+		return
+	}
+	canceled := []runResp{}
+	for _, swf := range runs {
+		canceled = append(canceled, runResponse(swf, wf))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": ctrl.reloadWorkflow(wf), "canceledRuns": canceled})
+}
+
+// resumeWorkflow handles POST /v1/workflow/:name/resume
+func (ctrl *Control) resumeWorkflow(c *gin.Context) {
+	name := c.Param("name")
+	var body resumeWorkflowReq
+	if err := c.BindJSON(&body); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var wf table.Workflow
+	if ctrl.db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+
+	err := resumeWorkflow(ctrl.db, wf, workflowResume{Actor: body.Actor, Reason: body.Reason})
+	if errors.Is(err, errWorkflowNotPaused) {
+		c.JSON(http.StatusConflict, gin.H{"name": name, "error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"name": name, "error": err.Error()})
+		return
+	}
+	fmt.Printf("workflow (name: %s) resumed by %s: %s\n", wf.Name, body.Actor, body.Reason)
+	c.JSON(http.StatusOK, gin.H{"data": ctrl.reloadWorkflow(wf)})
+}
+
+// reloadWorkflow reads wf back for the response of the endpoints updating it
+func (ctrl *Control) reloadWorkflow(wf table.Workflow) getWorkflowResp {
+	var workflow table.Workflow
+	preloadDefinition(ctrl.db).First(&workflow, wf.ID)
+	return workflowResponse(workflow)
+}
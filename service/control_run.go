@@ -0,0 +1,237 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/metrics"
+)
+
+type triggerWorkflowReq struct {
+	LogicalTime *time.Time `json:"logicalTime"` // scheduled start time of the run, now if absent
+}
+
+type runResp struct {
+	ID                 uint       `json:"id"`
+	WorkflowName       string     `json:"workflowName"`
+	OrchardID          string     `json:"orchardId"`
+	ScheduledStartTime time.Time  `json:"scheduledStartTime"`
+	StartTime          time.Time  `json:"startTime"`
+	Status             string     `json:"status"`
+	Reason             string     `json:"reason"`
+	SkippedUntil       *time.Time `json:"skippedUntil,omitempty"`
+	ActivatedAt        *time.Time `json:"activatedAt"`
+	CompletedAt        *time.Time `json:"completedAt"`
+	DurationSeconds    int64      `json:"durationSeconds"`
+	TriggerType        string     `json:"triggerType"`
+	BackfillID         *uint      `json:"backfillId"`
+	RunID              string     `json:"runId"`
+	WorkflowVersion    uint       `json:"workflowVersion"`
+}
+
+func runResponse(swf table.ScheduledWorkflow, wf table.Workflow) runResp {
+	return runResp{
+		ID:                 swf.ID,
+		WorkflowName:       wf.Name,
+		OrchardID:          swf.OrchardID,
+		ScheduledStartTime: swf.ScheduledStartTime,
+		StartTime:          swf.StartTime,
+		Status:             swf.Status,
+		Reason:             swf.Reason,
+		SkippedUntil:       swf.SkippedUntil,
+		ActivatedAt:        swf.ActivatedAt,
+		CompletedAt:        swf.CompletedAt,
+		DurationSeconds:    swf.DurationSeconds,
+		TriggerType:        swf.TriggerType,
+		BackfillID:         swf.BackfillID,
+		RunID:              swf.RunID,
+		WorkflowVersion:    swf.WorkflowVersion,
+	}
+}
+
+// getWorkflowRuns handles GET /v1/workflow/:name/runs
+// Query parameters:
+//   - orderBy: field to sort by (default: "scheduledStartTime")
+//   - orderDir: sort direction ("asc" or "desc", default: "desc")
+//   - page: page number (default: 1)
+//   - limit: items per page (default: 50)
+//   - status: comma separated statuses to keep
+//   - from: RFC 3339 time, runs scheduled at or after it
+//   - to: RFC 3339 time, runs scheduled before it
+func (ctrl *Control) getWorkflowRuns(c *gin.Context) {
+	start := time.Now()
+	name := c.Param("name")
+
+	var wf table.Workflow
+	if ctrl.db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+
+	query := ctrl.db.Model(&table.ScheduledWorkflow{}).Where("workflow_id = ?", wf.ID)
+
+	if statusStr := c.Query("status"); statusStr != "" {
+		statuses := strings.Split(statusStr, ",")
+		for _, status := range statuses {
+			if !validScheduleStatus(status) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "invalid_status",
+					Code:    "400",
+					Message: fmt.Sprintf("Invalid status: %s", status),
+				})
+				return
+			}
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+
+	for param, condition := range map[string]string{
+		"from": "scheduled_start_time >= ?",
+		"to":   "scheduled_start_time < ?",
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   fmt.Sprintf("invalid_%s_value", param),
+				Code:    "400",
+				Message: fmt.Sprintf("%s must be an RFC 3339 time", param),
+			})
+			return
+		}
+		query = query.Where(condition, t)
+	}
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	columnMap := map[string]string{
+		"scheduledStartTime": "scheduled_start_time",
+		"startTime":          "start_time",
+		"status":             "status",
+		"completedAt":        "completed_at",
+		"durationSeconds":    "duration_seconds",
+	}
+	order, ok := parseOrder(c, "scheduledStartTime", "desc", columnMap)
+	if !ok {
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	var runs []table.ScheduledWorkflow
+	result := query.WithContext(ctx).
+		Order(order).
+		Order("id").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&runs)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	response := []runResp{}
+	for _, swf := range runs {
+		response = append(response, runResponse(swf, wf))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":       response,
+		"pagination": paginationResponse(total, page, limit),
+	})
+
+	metrics.UpdateHistogram("http_request_duration_seconds", time.Since(start), map[string]string{"route": "get_workflow_runs"})
+	metrics.IncrementCounter("http_requests_total", map[string]string{"route": "get_workflow_runs"})
+}
+
+// getRun handles GET /v1/runs/:id
+func (ctrl *Control) getRun(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_run_id",
+			Code:    "400",
+			Message: "run id must be a positive integer",
+		})
+		return
+	}
+
+	var swf table.ScheduledWorkflow
+	if ctrl.db.Limit(1).Find(&swf, id).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Run not found:": fmt.Sprintf("id=%d", id)})
+		return
+	}
+	// runs outlive the definition of a deleted workflow
+	var wf table.Workflow
+	ctrl.db.Unscoped().Limit(1).Find(&wf, swf.WorkflowID)
+	c.IndentedJSON(http.StatusOK, runResponse(swf, wf))
+}
+
+// triggerWorkflow handles POST /v1/workflow/:name/trigger, the body is optional
+func (ctrl *Control) triggerWorkflow(c *gin.Context) {
+	name := c.Param("name")
+	var body triggerWorkflowReq
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&body); err != nil {
+			// bad request
+			fmt.Println(err)
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	logicalTime := time.Now()
+	if body.LogicalTime != nil {
+		logicalTime = *body.LogicalTime
+	}
+
+	var wf table.Workflow
+	if ctrl.db.Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+
+	runs, err := ctrl.scheduler.triggerWorkflow(c.Request.Context(), ctrl.db, wf, logicalTime)
+	if errors.Is(err, ErrWorkflowLocked) {
+		c.JSON(http.StatusConflict, gin.H{"name": name, "error": err.Error()})
+		return
+	}
+	response := []runResp{}
+	for _, swf := range runs {
+		response = append(response, runResponse(swf, wf))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"name": name, "error": err.Error(), "data": response})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+func validScheduleStatus(str string) bool {
+	for _, status := range ScheduleStatuses {
+		if status.ToString() == str {
+			return true
+		}
+	}
+	return false
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -53,7 +54,7 @@ func getMockDB(dbPath string) *gorm.DB {
 		Name:        deleteTestName,
 		Artifact:    "test.jar",
 		Command:     "java -jar test.jar",
-		Every:       model.Every{1, model.EveryDay},
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
 		NextRuntime: mockNextRuntime,
 		Backfill:    false,
 		IsActive:    true,
@@ -64,7 +65,7 @@ func getMockDB(dbPath string) *gorm.DB {
 		Name:        getTestName,
 		Artifact:    "test.jar",
 		Command:     "java -jar test.jar",
-		Every:       model.Every{1, model.EveryDay},
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
 		NextRuntime: mockNextRuntime,
 		Backfill:    false,
 		IsActive:    true,
@@ -75,7 +76,7 @@ func getMockDB(dbPath string) *gorm.DB {
 		Name:        authTestName,
 		Artifact:    "test.jar",
 		Command:     "java -jar test.jar",
-		Every:       model.Every{1, model.EveryDay},
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
 		NextRuntime: mockNextRuntime,
 		Backfill:    false,
 		IsActive:    true,
@@ -96,14 +97,42 @@ func staticNextRuntime() time.Time {
 	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
 }
 
-func TestDeleteWorkflow(t *testing.T) {
+// controlTest serves the control API on a new mock database
+type controlTest struct {
+	dbName string
+	db     *gorm.DB
+	ctrl   *Control
+	router *gin.Engine
+}
+
+func newControlTest(scheduler *Scheduler) *controlTest {
 	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
 	mockDB := getMockDB(dbName)
-	ctrl := &Control{db: mockDB}
-
+	ctrl := &Control{db: mockDB, scheduler: scheduler}
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.DELETE("/v1/workflow", ctrl.deleteWorkflow)
+	ctrl.routes(router.Group("/v1"))
+	return &controlTest{dbName: dbName, db: mockDB, ctrl: ctrl, router: router}
+}
+
+// send serves a JSON request, headers are pairs of name and value
+func (ct *controlTest) send(method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	ct.router.ServeHTTP(w, req)
+	return w
+}
+
+func (ct *controlTest) cleanup() {
+	cleanupDB(ct.db, ct.dbName)
+}
+
+func TestDeleteWorkflow(t *testing.T) {
+	ct := newControlTest(nil)
 
 	t.Run("Valid request", func(t *testing.T) {
 
@@ -114,7 +143,7 @@ func TestDeleteWorkflow(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
@@ -128,7 +157,7 @@ func TestDeleteWorkflow(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
@@ -138,20 +167,15 @@ func TestDeleteWorkflow(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
-	cleanupDB(mockDB, dbName)
+	ct.cleanup()
 }
 
 func TestPutWorkflow(t *testing.T) {
-	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
-	mockDB := getMockDB(dbName)
-	ctrl := &Control{db: mockDB}
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	router.PUT("/v1/workflow", ctrl.putWorkflow)
+	ct := newControlTest(nil)
 
 	t.Run("Valid request", func(t *testing.T) {
 
@@ -170,7 +194,7 @@ func TestPutWorkflow(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 		assert.Equal(t, "\"OK\"", w.Body.String())
@@ -181,7 +205,7 @@ func TestPutWorkflow(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
@@ -200,27 +224,210 @@ func TestPutWorkflow(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
-	cleanupDB(mockDB, dbName)
+
+	t.Run("Invalid request - invalid command template", func(t *testing.T) {
+		body := putWorkflowReq{
+			Name:            "invalid_put_test",
+			Artifact:        "test.jar",
+			Command:         `["java", "-jar", "test.jar", "{{.ScheduledStartTime | date}}"]`,
+			Every:           "1.day",
+			NextRuntime:     time.Now(),
+			TemplateCommand: true,
+		}
+		jsonBody, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid request - invalid 'timezone' field", func(t *testing.T) {
+		body := putWorkflowReq{
+			Name:        "invalid_put_test",
+			Artifact:    "test.jar",
+			Command:     "java -jar test.jar",
+			Every:       "1.day",
+			NextRuntime: time.Now(),
+			Timezone:    "Mars/Olympus_Mons",
+		}
+		jsonBody, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid request - fire_last_n without misfireLastN", func(t *testing.T) {
+		body := putWorkflowReq{
+			Name:          "invalid_put_test",
+			Artifact:      "test.jar",
+			Command:       "java -jar test.jar",
+			Every:         "1.day",
+			NextRuntime:   time.Now(),
+			MisfirePolicy: "fire_last_n",
+		}
+		jsonBody, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Backfill maps to the fire_all misfire policy", func(t *testing.T) {
+		body := putWorkflowReq{
+			Name:        "backfill_put_test",
+			Artifact:    "test.jar",
+			Command:     "java -jar test.jar",
+			Every:       "1.day",
+			NextRuntime: staticNextRuntime(),
+			Backfill:    true,
+		}
+		jsonBody, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var wf table.Workflow
+		ct.db.Where("name = ?", "backfill_put_test").First(&wf)
+		assert.Equal(t, model.MisfireFireAll, wf.MisfirePolicy)
+	})
+	ct.cleanup()
+}
+
+func TestPutWorkflowDependsOn(t *testing.T) {
+	ct := newControlTest(nil)
+
+	put := func(name string, dependsOn []string) int {
+		body := putWorkflowReq{
+			Name:        name,
+			Artifact:    "test.jar",
+			Command:     "java -jar test.jar",
+			Every:       "1.day",
+			NextRuntime: staticNextRuntime(),
+			DependsOn:   dependsOn,
+		}
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, put("dep_a", nil))
+	assert.Equal(t, http.StatusOK, put("dep_b", []string{"dep_a"}))
+
+	req, _ := http.NewRequest("GET", "/v1/workflow/dep_b", nil)
+	w := httptest.NewRecorder()
+	ct.router.ServeHTTP(w, req)
+	var response getWorkflowResp
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []string{"dep_a"}, response.DependsOn)
+
+	t.Run("Unknown upstream", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, put("dep_c", []string{"missing"}))
+	})
+
+	t.Run("Self dependency", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, put("dep_a", []string{"dep_a"}))
+	})
+
+	t.Run("Dependency cycle", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, put("dep_a", []string{"dep_b"}))
+	})
+
+	ct.cleanup()
+}
+
+func TestPutWorkflowParameters(t *testing.T) {
+	ct := newControlTest(nil)
+
+	put := func(command string, params model.Parameters) int {
+		body := putWorkflowReq{
+			Name:            "params_test",
+			Artifact:        "test.jar",
+			Command:         command,
+			Every:           "1.day",
+			NextRuntime:     staticNextRuntime(),
+			Parameters:      params,
+			TemplateCommand: true,
+		}
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	get := func() getWorkflowResp {
+		req, _ := http.NewRequest("GET", "/v1/workflow/params_test", nil)
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		var response getWorkflowResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	stored := func() model.Parameters {
+		var wf table.Workflow
+		ct.db.Where("name = ?", "params_test").First(&wf)
+		return wf.Parameters
+	}
+
+	command := `["java", "-jar", "test.jar", "{{.Params.tenant}}"]`
+	assert.Equal(t, http.StatusOK, put(command, model.Parameters{
+		"tenant": {Value: "acme"},
+		"token":  {Value: "s3cr3t", Type: model.ParameterSecret},
+	}))
+	response := get()
+	assert.Equal(t, "acme", response.Parameters["tenant"].Value)
+	assert.Equal(t, model.ParameterString, response.Parameters["tenant"].Type)
+	assert.Equal(t, model.RedactedValue, response.Parameters["token"].Value)
+	assert.Equal(t, "s3cr3t", stored()["token"].Value)
+
+	t.Run("Redacted secrets are kept", func(t *testing.T) {
+		response.Parameters["tenant"] = model.Parameter{Value: "globex"}
+		assert.Equal(t, http.StatusOK, put(command, response.Parameters))
+		assert.Equal(t, "s3cr3t", stored()["token"].Value)
+		assert.Equal(t, "globex", stored()["tenant"].Value)
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, put(command, model.Parameters{"ten-ant": {Value: "acme"}}))
+		assert.Equal(t, http.StatusBadRequest, put(command, model.Parameters{"region": {Value: "us"}}))
+	})
+
+	ct.cleanup()
 }
 
 func TestGetWorkflow(t *testing.T) {
-	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
-	mockDB := getMockDB(dbName)
-	ctrl := &Control{db: mockDB}
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	router.GET("/v1/workflow/:name", ctrl.getWorkflow)
+	ct := newControlTest(nil)
 
 	t.Run("Existing workflow", func(t *testing.T) {
 		workflow := table.Workflow{
 			Name:        getTestName,
 			Artifact:    "test.jar",
 			Command:     "java -jar test.jar",
-			Every:       model.Every{1, model.EveryDay},
+			Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
 			NextRuntime: staticNextRuntime(),
 			Backfill:    false,
 			IsActive:    true,
@@ -230,7 +437,7 @@ func TestGetWorkflow(t *testing.T) {
 		req, _ := http.NewRequest("GET", testPath, nil)
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
@@ -250,11 +457,11 @@ func TestGetWorkflow(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1//workflow/nonexistent", nil)
 
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
-	cleanupDB(mockDB, dbName)
+	ct.cleanup()
 }
 
 func TestAPIKeyAuth(t *testing.T) {
@@ -464,12 +671,7 @@ func TestHandleAuth(t *testing.T) {
 }
 
 func TestGetWorkflows(t *testing.T) {
-	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
-	mockDB := getMockDB(dbName)
-	ctrl := &Control{db: mockDB}
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	router.GET("/v1/workflows", ctrl.getWorkflows)
+	ct := newControlTest(nil)
 
 	// Create additional test workflows with different properties
 	testWorkflows := []table.Workflow{
@@ -477,7 +679,7 @@ func TestGetWorkflows(t *testing.T) {
 			Name:                 "workflow_a",
 			Artifact:             "artifact_a.jar",
 			Command:              "java -jar a.jar",
-			Every:                model.Every{1, model.EveryDay},
+			Every:                model.Every{Quantity: 1, Unit: model.EveryDay},
 			NextRuntime:          time.Now().Add(24 * time.Hour),
 			Backfill:             false,
 			Owner:                stringPtr("team_a"),
@@ -488,7 +690,7 @@ func TestGetWorkflows(t *testing.T) {
 			Name:                 "workflow_b",
 			Artifact:             "artifact_b.jar",
 			Command:              "java -jar b.jar",
-			Every:                model.Every{2, model.EveryDay},
+			Every:                model.Every{Quantity: 2, Unit: model.EveryDay},
 			NextRuntime:          time.Now().Add(48 * time.Hour),
 			Backfill:             true,
 			Owner:                stringPtr("team_b"),
@@ -499,7 +701,7 @@ func TestGetWorkflows(t *testing.T) {
 			Name:                 "workflow_c",
 			Artifact:             "artifact_c.jar",
 			Command:              "java -jar c.jar",
-			Every:                model.Every{1, model.EveryWeek},
+			Every:                model.Every{Quantity: 1, Unit: model.EveryWeek},
 			NextRuntime:          time.Now().Add(72 * time.Hour),
 			Backfill:             false,
 			Owner:                stringPtr("team_c"),
@@ -510,7 +712,7 @@ func TestGetWorkflows(t *testing.T) {
 			Name:                 "test4_workflows",
 			Artifact:             "test_artifact.jar",
 			Command:              "java -jar test.jar",
-			Every:                model.Every{1, model.EveryDay},
+			Every:                model.Every{Quantity: 1, Unit: model.EveryDay},
 			NextRuntime:          time.Now().Add(96 * time.Hour),
 			Backfill:             false,
 			Owner:                stringPtr("test_team"),
@@ -521,14 +723,14 @@ func TestGetWorkflows(t *testing.T) {
 
 	// Insert test workflows
 	for _, wf := range testWorkflows {
-		result := mockDB.Create(&wf)
+		result := ct.db.Create(&wf)
 		assert.NoError(t, result.Error, "Failed to create test workflow: %v", wf.Name)
 	}
 
 	t.Run("Default ordering by name", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
@@ -555,7 +757,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Order by nextRuntime ascending", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?orderBy=nextRuntime&orderDir=asc", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
@@ -582,7 +784,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Order by isActive descending", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?orderBy=isActive&orderDir=desc", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
@@ -615,7 +817,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Order by scheduleDelayMinutes ascending", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?orderBy=scheduleDelayMinutes&orderDir=asc", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
@@ -642,7 +844,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Invalid order direction", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?orderBy=name&orderDir=invalid", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
@@ -650,7 +852,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Invalid orderBy field", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?orderBy=invalidField&orderDir=asc", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 
@@ -663,7 +865,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Filter by name pattern", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?like=test4", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
@@ -695,7 +897,7 @@ func TestGetWorkflows(t *testing.T) {
 		for _, pattern := range validPatterns {
 			req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/workflows?like=%s", pattern), nil)
 			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
+			ct.router.ServeHTTP(w, req)
 
 			assert.Equal(t, http.StatusOK, w.Code, "Pattern should be accepted: "+pattern)
 		}
@@ -704,7 +906,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Pagination", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?page=1&limit=2", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
@@ -726,7 +928,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Invalid page parameter", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?page=invalid", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 
@@ -739,7 +941,7 @@ func TestGetWorkflows(t *testing.T) {
 	t.Run("Invalid limit parameter", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/workflows?limit=invalid", nil)
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		ct.router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 
@@ -749,10 +951,880 @@ func TestGetWorkflows(t *testing.T) {
 		assert.Contains(t, response.Message, "limit must be a positive integer")
 	})
 
-	cleanupDB(mockDB, dbName)
+	ct.cleanup()
+}
+
+func TestCalendars(t *testing.T) {
+	ct := newControlTest(nil)
+
+	t.Run("Put calendar", func(t *testing.T) {
+		body := putCalendarReq{
+			Name:   "freeze",
+			Action: "defer",
+			WeeklyWindows: model.WeeklyWindows{
+				{Day: "sat", Start: "22:00", End: "04:00"},
+			},
+		}
+		jsonBody, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest("PUT", "/v1/calendar", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ = http.NewRequest("GET", "/v1/calendar/freeze", nil)
+		w = httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response putCalendarReq
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "defer", response.Action)
+		assert.Equal(t, "UTC", response.Timezone)
+		assert.Equal(t, body.WeeklyWindows, response.WeeklyWindows)
+	})
+
+	t.Run("Invalid calendar window", func(t *testing.T) {
+		body := putCalendarReq{
+			Name:          "invalid",
+			WeeklyWindows: model.WeeklyWindows{{Day: "someday", Start: "22:00", End: "04:00"}},
+		}
+		jsonBody, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest("PUT", "/v1/calendar", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Workflow referencing calendars", func(t *testing.T) {
+		body := putWorkflowReq{
+			Name:        "calendar_test",
+			Artifact:    "test.jar",
+			Command:     "java -jar test.jar",
+			Every:       "1.day",
+			NextRuntime: staticNextRuntime(),
+			Calendars:   []string{"freeze"},
+		}
+		jsonBody, _ := json.Marshal(body)
+
+		req, _ := http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ = http.NewRequest("GET", "/v1/workflow/calendar_test", nil)
+		w = httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		var response putWorkflowReq
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, []string{"freeze"}, response.Calendars)
+
+		body.Calendars = []string{"nonexistent"}
+		jsonBody, _ = json.Marshal(body)
+		req, _ = http.NewRequest("PUT", "/v1/workflow", bytes.NewBuffer(jsonBody))
+		w = httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	ct.cleanup()
 }
 
 // Helper function to create string pointers
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestGetWorkflowRuns(t *testing.T) {
+	ct := newControlTest(nil)
+
+	var wf table.Workflow
+	ct.db.Where("name = ?", getTestName).First(&wf)
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var runIDs []uint
+	for i, status := range []string{Finished.ToString(), Failed.ToString(), Skipped.ToString(), Activated.ToString()} {
+		swf := table.ScheduledWorkflow{
+			WorkflowID:         wf.ID,
+			OrchardID:          fmt.Sprintf("wf-%d", i),
+			StartTime:          base.Add(time.Duration(i) * time.Hour),
+			ScheduledStartTime: base.Add(time.Duration(i) * time.Hour),
+			Status:             status,
+		}
+		assert.NoError(t, ct.db.Create(&swf).Error)
+		runIDs = append(runIDs, swf.ID)
+	}
+
+	getRuns := func(query string) (int, []runResp, gin.H) {
+		req, _ := http.NewRequest("GET", "/v1/workflow/"+getTestName+"/runs"+query, nil)
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		var response struct {
+			Data       []runResp `json:"data"`
+			Pagination gin.H     `json:"pagination"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data, response.Pagination
+	}
+
+	t.Run("Latest first by default", func(t *testing.T) {
+		code, runs, pagination := getRuns("")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 4, len(runs))
+		assert.Equal(t, "wf-3", runs[0].OrchardID)
+		assert.Equal(t, getTestName, runs[0].WorkflowName)
+		assert.Equal(t, float64(4), pagination["total"])
+	})
+
+	t.Run("Filter by status and time range", func(t *testing.T) {
+		code, runs, _ := getRuns("?status=finished,failed&from=2024-05-01T01:00:00Z")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, len(runs))
+		assert.Equal(t, Failed.ToString(), runs[0].Status)
+
+		code, runs, _ = getRuns("?to=2024-05-01T01:00:00Z&orderDir=asc")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, len(runs))
+		assert.Equal(t, "wf-0", runs[0].OrchardID)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		code, runs, pagination := getRuns("?limit=3&page=2&orderBy=startTime&orderDir=asc")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, len(runs))
+		assert.Equal(t, "wf-3", runs[0].OrchardID)
+		assert.Equal(t, float64(2), pagination["totalPages"])
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"?status=bogus", "?from=yesterday", "?orderBy=orchardId", "?page=0"} {
+			code, _, _ := getRuns(query)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+		}
+	})
+
+	t.Run("Unknown workflow", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/workflow/missing/runs", nil)
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Single run", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/runs/%d", runIDs[1]), nil)
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var run runResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		assert.Equal(t, "wf-1", run.OrchardID)
+		assert.True(t, run.ScheduledStartTime.Equal(base.Add(time.Hour)))
+
+		req, _ = http.NewRequest("GET", "/v1/runs/999999", nil)
+		w = httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	ct.cleanup()
+}
+
+func TestTriggerWorkflow(t *testing.T) {
+	ct := newControlTest(&Scheduler{})
+
+	var wf table.Workflow
+	ct.db.Where("name = ?", getTestName).First(&wf)
+
+	trigger := func(name string, body string) int {
+		req, _ := http.NewRequest("POST", "/v1/workflow/"+name+"/trigger", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Unknown workflow", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, trigger("missing", ""))
+	})
+
+	t.Run("Invalid logical time", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, trigger(getTestName, `{"logicalTime": "yesterday"}`))
+	})
+
+	t.Run("Locked by the scheduler", func(t *testing.T) {
+		lock := table.WorkflowSchedulerLock{WorkflowID: wf.ID, Token: "held", LockTime: time.Now()}
+		assert.NoError(t, ct.db.Create(&lock).Error)
+		assert.Equal(t, http.StatusConflict, trigger(getTestName, ""))
+		ct.db.Delete(&lock)
+	})
+
+	t.Run("Failed generation leaves the schedule alone", func(t *testing.T) {
+		// test.jar is not an artifact the generator can run
+		assert.Equal(t, http.StatusBadGateway, trigger(getTestName, `{"logicalTime": "2024-05-01T00:00:00Z"}`))
+
+		var updated table.Workflow
+		ct.db.First(&updated, wf.ID)
+		assert.True(t, updated.NextRuntime.Equal(wf.NextRuntime))
+		var count int64
+		ct.db.Model(&table.WorkflowSchedulerLock{}).Where("workflow_id = ?", wf.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	ct.cleanup()
+}
+
+func TestBackfillEndpoints(t *testing.T) {
+	ct := newControlTest(&Scheduler{})
+
+	request := func(method string, path string, body string) (int, backfillResp) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		var response backfillResp
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, bf := request("POST", "/v1/workflow/"+getTestName+"/backfill",
+		`{"from": "2024-05-01T00:00:00Z", "to": "2024-05-08T00:00:00Z", "maxParallelism": 2}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "running", bf.Status)
+	assert.Equal(t, int64(7), bf.Runs[Queued.ToString()])
+	assert.Equal(t, uint(2), bf.MaxParallelism)
+
+	code, bf = request("GET", fmt.Sprintf("/v1/backfill/%d", bf.ID), "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, getTestName, bf.WorkflowName)
+
+	code, bf = request("POST", fmt.Sprintf("/v1/backfill/%d/cancel", bf.ID), "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "canceled", bf.Status)
+	assert.Equal(t, int64(7), bf.Runs[Canceled.ToString()])
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		code, _ := request("POST", "/v1/workflow/"+getTestName+"/backfill",
+			`{"from": "2024-05-08T00:00:00Z", "to": "2024-05-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = request("POST", "/v1/workflow/"+getTestName+"/backfill",
+			fmt.Sprintf(`{"from": "2024-05-01T00:00:00Z", "to": "%s"}`, time.Now().Add(48*time.Hour).Format(time.RFC3339)))
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = request("POST", "/v1/workflow/missing/backfill",
+			`{"from": "2024-05-01T00:00:00Z", "to": "2024-05-08T00:00:00Z"}`)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = request("GET", "/v1/backfill/999999", "")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	ct.cleanup()
+}
+
+func TestPauseWorkflow(t *testing.T) {
+	deleted := []string{}
+	orchardServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer orchardServer.Close()
+	ct := newControlTest(&Scheduler{OrchardHost: orchardServer.URL})
+
+	var wf table.Workflow
+	ct.db.Where("name = ?", getTestName).First(&wf)
+	created := table.ScheduledWorkflow{
+		WorkflowID:         wf.ID,
+		OrchardID:          "wf-created",
+		StartTime:          time.Now(),
+		ScheduledStartTime: time.Now(),
+		Status:             Created.ToString(),
+	}
+	assert.NoError(t, ct.db.Create(&created).Error)
+
+	post := func(path string, body string) int {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	get := func() getWorkflowResp {
+		req, _ := http.NewRequest("GET", "/v1/workflow/"+getTestName, nil)
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		var response getWorkflowResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, post("/v1/workflow/"+getTestName+"/pause", `{"reason": "no actor"}`))
+		assert.Equal(t, http.StatusBadRequest, post("/v1/workflow/"+getTestName+"/pause",
+			`{"actor": "ops", "resumeAt": "2020-01-01T00:00:00Z"}`))
+		assert.Equal(t, http.StatusNotFound, post("/v1/workflow/missing/pause", `{"actor": "ops"}`))
+		assert.Equal(t, http.StatusNotFound, post("/v1/workflow/missing/resume", `{"actor": "ops"}`))
+	})
+
+	t.Run("Pause", func(t *testing.T) {
+		resumeAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		body := fmt.Sprintf(`{"actor": "ops", "reason": "upstream outage", "resumeAt": "%s", "cancelCreated": true}`,
+			resumeAt.Format(time.RFC3339))
+		assert.Equal(t, http.StatusOK, post("/v1/workflow/"+getTestName+"/pause", body))
+
+		response := get()
+		assert.False(t, response.IsActive)
+		assert.True(t, response.Paused)
+		assert.Equal(t, "ops", response.PausedBy)
+		assert.Equal(t, "upstream outage", response.PauseReason)
+		assert.True(t, response.ResumeAt.Equal(resumeAt))
+
+		assert.Equal(t, []string{"/v1/workflow/wf-created"}, deleted)
+		ct.db.First(&created, created.ID)
+		assert.Equal(t, Deleted.ToString(), created.Status)
+		assert.Equal(t, "workflow paused", created.Reason)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, post("/v1/workflow/"+getTestName+"/resume", `{"actor": "ops", "reason": "outage over"}`))
+
+		response := get()
+		assert.True(t, response.IsActive)
+		assert.False(t, response.Paused)
+		assert.Nil(t, response.ResumeAt)
+		assert.NotNil(t, response.ResumedAt)
+		assert.Equal(t, "ops", response.ResumedBy)
+		assert.Equal(t, "outage over", response.ResumeReason)
+		// the last pause is kept
+		assert.Equal(t, "ops", response.PausedBy)
+		assert.Equal(t, "upstream outage", response.PauseReason)
+	})
+
+	t.Run("Resume a workflow that is not paused", func(t *testing.T) {
+		resumedAt := get().ResumedAt
+		assert.Equal(t, http.StatusConflict, post("/v1/workflow/"+getTestName+"/resume", `{"actor": "ops"}`))
+		assert.True(t, get().ResumedAt.Equal(*resumedAt))
+	})
+
+	ct.cleanup()
+}
+
+func TestPatchWorkflow(t *testing.T) {
+	ct := newControlTest(nil)
+	mockDB := ct.db
+	get := func() (getWorkflowResp, string) {
+		w := ct.send("GET", "/v1/workflow/"+getTestName, "")
+		var response getWorkflowResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response, w.Header().Get("ETag")
+	}
+
+	before, etag := get()
+	assert.Equal(t, `"1"`, etag)
+
+	t.Run("Patch only writes the patched fields", func(t *testing.T) {
+		// the scheduler moves the next runtime after the workflow was read
+		movedRuntime := mockNextRuntime.Add(24 * time.Hour)
+		mockDB.Model(&table.Workflow{}).Where("name = ?", getTestName).Update("next_runtime", movedRuntime)
+
+		w := ct.send("PATCH", "/v1/workflow/"+getTestName, `{"maxRuns": 5, "parameters": {"tenant": {"value": "acme"}}}`, "If-Match", etag)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+		after, etag := get()
+		assert.Equal(t, `"2"`, etag)
+		assert.Equal(t, uint(5), after.MaxRuns)
+		assert.Equal(t, "acme", after.Parameters["tenant"].Value)
+		assert.Equal(t, before.Command, after.Command)
+		assert.True(t, after.NextRuntime.Equal(movedRuntime))
+	})
+
+	t.Run("Merge patch removes members set to null", func(t *testing.T) {
+		w := ct.send("PATCH", "/v1/workflow/"+getTestName, `{"parameters": {"tenant": null, "region": {"value": "us"}}}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		after, _ := get()
+		assert.Equal(t, model.Parameters{"region": {Value: "us", Type: model.ParameterString}}, after.Parameters)
+	})
+
+	t.Run("Stale If-Match", func(t *testing.T) {
+		w := ct.send("PATCH", "/v1/workflow/"+getTestName, `{"maxRuns": 6}`, "If-Match", `"1"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		body := putWorkflowReq{
+			Name:        getTestName,
+			Artifact:    "test.jar",
+			Command:     "java -jar test.jar",
+			Every:       "1.day",
+			NextRuntime: staticNextRuntime(),
+		}
+		jsonBody, _ := json.Marshal(body)
+		w = ct.send("PUT", "/v1/workflow", string(jsonBody), "If-Match", `"1"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		_, etag := get()
+		w = ct.send("PUT", "/v1/workflow", string(jsonBody), "If-Match", etag)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	})
+
+	t.Run("Invalid patches", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, ct.send("PATCH", "/v1/workflow/"+getTestName, `{"command": null}`).Code)
+		assert.Equal(t, http.StatusBadRequest, ct.send("PATCH", "/v1/workflow/"+getTestName, `{"name": "renamed"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, ct.send("PATCH", "/v1/workflow/"+getTestName, `{"every": "invalid"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, ct.send("PATCH", "/v1/workflow/"+getTestName, `[]`).Code)
+		assert.Equal(t, http.StatusNotFound, ct.send("PATCH", "/v1/workflow/missing", `{"maxRuns": 1}`).Code)
+	})
+
+	ct.cleanup()
+}
+
+func TestWorkflowVersions(t *testing.T) {
+	ct := newControlTest(nil)
+	mockDB := ct.db
+	versions := func() []versionResp {
+		w := ct.send("GET", "/v1/workflow/versions_test/versions", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []versionResp `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	body := putWorkflowReq{
+		Name:        "versions_test",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       "1.day",
+		NextRuntime: staticNextRuntime(),
+		IsActive:    true,
+		Parameters:  model.Parameters{"token": {Value: "s3cr3t", Type: model.ParameterSecret}},
+	}
+	jsonBody, _ := json.Marshal(body)
+	assert.Equal(t, http.StatusOK, ct.send("PUT", "/v1/workflow", string(jsonBody)).Code)
+	assert.Equal(t, http.StatusOK, ct.send("PATCH", "/v1/workflow/versions_test", `{"command": "java -jar test2.jar"}`).Code)
+
+	history := versions()
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, uint(2), history[0].Version)
+	assert.Equal(t, versionPatch, history[0].Action)
+	assert.Equal(t, "java -jar test2.jar", history[0].Definition.Command)
+	assert.Equal(t, versionPut, history[1].Action)
+	assert.Equal(t, "java -jar test.jar", history[1].Definition.Command)
+	assert.Equal(t, model.RedactedValue, history[1].Definition.Parameters["token"].Value)
+
+	t.Run("Rollback", func(t *testing.T) {
+		// the schedule progress is not rolled back
+		movedRuntime := staticNextRuntime().Add(48 * time.Hour)
+		mockDB.Model(&table.Workflow{}).Where("name = ?", "versions_test").Update("next_runtime", movedRuntime)
+
+		w := ct.send("POST", "/v1/workflow/versions_test/rollback?version=1", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+		var wf table.Workflow
+		mockDB.Where("name = ?", "versions_test").First(&wf)
+		assert.Equal(t, "java -jar test.jar", wf.Command)
+		assert.Equal(t, "s3cr3t", wf.Parameters["token"].Value)
+		assert.True(t, wf.NextRuntime.Equal(movedRuntime))
+		assert.Equal(t, versionRollback, versions()[0].Action)
+	})
+
+	t.Run("Invalid rollbacks", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, ct.send("POST", "/v1/workflow/versions_test/rollback", "").Code)
+		assert.Equal(t, http.StatusNotFound, ct.send("POST", "/v1/workflow/versions_test/rollback?version=42", "").Code)
+		assert.Equal(t, http.StatusNotFound, ct.send("POST", "/v1/workflow/missing/rollback?version=1", "").Code)
+	})
+
+	t.Run("Delete is recorded", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, ct.send("DELETE", "/v1/workflow", `{"name": "versions_test"}`).Code)
+		history := versions()
+		assert.Equal(t, 4, len(history))
+		assert.Equal(t, versionDelete, history[0].Action)
+		assert.Equal(t, http.StatusNotFound, ct.send("POST", "/v1/workflow/versions_test/rollback?version=1", "").Code)
+	})
+
+	ct.cleanup()
+}
+
+func TestRestoreWorkflow(t *testing.T) {
+	ct := newControlTest(nil)
+	mockDB := ct.db
+	list := func(query string) []getWorkflowResp {
+		w := ct.send("GET", "/v1/workflows"+query, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []getWorkflowResp `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	var wf table.Workflow
+	mockDB.Where("name = ?", deleteTestName).First(&wf)
+	swf := table.ScheduledWorkflow{WorkflowID: wf.ID, StartTime: time.Now(), ScheduledStartTime: time.Now(), Status: Created.ToString()}
+	assert.NoError(t, mockDB.Create(&swf).Error)
+	assert.NoError(t, mockDB.Create(&table.WorkflowSchedulerLock{WorkflowID: wf.ID, Token: "stale", LockTime: time.Now()}).Error)
+	assert.NoError(t, mockDB.Create(&table.WorkflowActivatorLock{ScheduledID: swf.ID, Token: "stale", LockTime: time.Now()}).Error)
+	assert.Equal(t, http.StatusOK, ct.send("DELETE", "/v1/workflow", fmt.Sprintf(`{"name": "%s"}`, deleteTestName)).Code)
+
+	deleted := list("?deleted=true")
+	assert.Equal(t, 1, len(deleted))
+	assert.Equal(t, deleteTestName, deleted[0].Name)
+	assert.NotNil(t, deleted[0].DeletedAt)
+	for _, workflow := range list("") {
+		assert.NotEqual(t, deleteTestName, workflow.Name)
+	}
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, ct.send("GET", "/v1/workflows?deleted=maybe", "").Code)
+		assert.Equal(t, http.StatusConflict, ct.send("POST", "/v1/workflow/"+getTestName+"/restore", "").Code)
+		assert.Equal(t, http.StatusNotFound, ct.send("POST", "/v1/workflow/missing/restore", "").Code)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		w := ct.send("POST", "/v1/workflow/"+deleteTestName+"/restore", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response getWorkflowResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.IsActive)
+		assert.Nil(t, response.DeletedAt)
+		assert.Equal(t, "java -jar test.jar", response.Command)
+		assert.Empty(t, list("?deleted=true"))
+
+		var count int64
+		mockDB.Model(&table.WorkflowSchedulerLock{}).Where("workflow_id = ?", wf.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+		mockDB.Model(&table.WorkflowActivatorLock{}).Where("scheduled_id = ?", swf.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	ct.cleanup()
+}
+
+func TestPurgeWorkflows(t *testing.T) {
+	ct := newControlTest(nil)
+
+	purge := func(query string) (int, purgeReport) {
+		req, _ := http.NewRequest("POST", "/v1/workflows/purge"+query, nil)
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		var report purgeReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+
+	var old, recent, kept table.Workflow
+	ct.db.Where("name = ?", deleteTestName).First(&old)
+	ct.db.Where("name = ?", authTestName).First(&recent)
+	ct.db.Where("name = ?", getTestName).First(&kept)
+	swf := table.ScheduledWorkflow{WorkflowID: old.ID, StartTime: time.Now(), ScheduledStartTime: time.Now(), Status: Finished.ToString()}
+	assert.NoError(t, ct.db.Create(&swf).Error)
+	assert.NoError(t, ct.db.Create(&table.WorkflowActivatorLock{ScheduledID: swf.ID, Token: "stale", LockTime: time.Now()}).Error)
+	assert.NoError(t, ct.db.Create(&table.WorkflowVersion{WorkflowID: old.ID, Version: 1, Action: versionPut, Definition: "{}"}).Error)
+	assert.NoError(t, ct.db.Create(&table.Backfill{WorkflowID: old.ID}).Error)
+	assert.NoError(t, ct.db.Create(&table.WorkflowDependency{WorkflowID: kept.ID, UpstreamID: old.ID}).Error)
+	ct.db.Delete(&old)
+	ct.db.Unscoped().Model(&old).Update("deleted_at", time.Now().Add(-60*24*time.Hour))
+	ct.db.Delete(&recent)
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		code, _ := purge("")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = purge("?olderThan=720h&dryRun=maybe")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		code, report := purge("?olderThan=720h&dryRun=true")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, []string{deleteTestName}, report.Workflows)
+		assert.Equal(t, int64(1), report.Runs)
+		assert.Equal(t, int64(1), report.Versions)
+		assert.Equal(t, int64(1), report.Backfills)
+		assert.Equal(t, int64(1), report.Locks)
+
+		var count int64
+		ct.db.Unscoped().Model(&table.Workflow{}).Where("id = ?", old.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		code, report := purge("?olderThan=720h")
+		assert.Equal(t, http.StatusOK, code)
+		assert.False(t, report.DryRun)
+		assert.Equal(t, []string{deleteTestName}, report.Workflows)
+
+		for _, rows := range []interface{}{&table.ScheduledWorkflow{}, &table.WorkflowVersion{}, &table.Backfill{}} {
+			var count int64
+			ct.db.Unscoped().Model(rows).Where("workflow_id = ?", old.ID).Count(&count)
+			assert.Equal(t, int64(0), count)
+		}
+		var count int64
+		ct.db.Unscoped().Model(&table.Workflow{}).Where("id IN ?", []uint{old.ID, recent.ID, kept.ID}).Count(&count)
+		assert.Equal(t, int64(2), count)
+		ct.db.Model(&table.WorkflowDependency{}).Where("upstream_id = ?", old.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+		ct.db.Model(&table.WorkflowActivatorLock{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	ct.cleanup()
+}
+
+func TestWorkflowLabels(t *testing.T) {
+	ct := newControlTest(&Scheduler{})
+	mockDB := ct.db
+	names := func(query string) []string {
+		w := ct.send("GET", "/v1/workflows"+query, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []getWorkflowResp `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		names := []string{}
+		for _, workflow := range response.Data {
+			names = append(names, workflow.Name)
+		}
+		return names
+	}
+	bulk := func(method string, path string, body string) bulkResp {
+		w := ct.send(method, path, body)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response bulkResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	for name, labels := range map[string]string{
+		"label_a": `{"env": "prod", "tier": "web"}`,
+		"label_b": `{"env": "prod", "tier": "batch"}`,
+		"label_c": `{"env": "dev", "example.com/cost-center": "42"}`,
+	} {
+		body := fmt.Sprintf(`{"name": "%s", "artifact": "test.jar", "command": "java -jar test.jar", "every": "1.day",
+			"nextRuntime": "2026-02-22T21:00:00Z", "isActive": true, "team": "data", "labels": %s}`, name, labels)
+		assert.Equal(t, http.StatusOK, ct.send("PUT", "/v1/workflow", body).Code, name)
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		w := ct.send("GET", "/v1/workflow/label_c", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response getWorkflowResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "data", response.Team)
+		assert.Equal(t, model.Labels{"env": "dev", "example.com/cost-center": "42"}, response.Labels)
+	})
+
+	t.Run("Invalid labels", func(t *testing.T) {
+		body := `{"name": "label_d", "artifact": "test.jar", "command": "java -jar test.jar", "every": "1.day",
+			"nextRuntime": "2026-02-22T21:00:00Z", "labels": {"bad key": "x"}}`
+		assert.Equal(t, http.StatusBadRequest, ct.send("PUT", "/v1/workflow", body).Code)
+		assert.Equal(t, http.StatusBadRequest, ct.send("GET", "/v1/workflows?selector=env%20in%20(prod", "").Code)
+		assert.Equal(t, http.StatusBadRequest, ct.send("POST", "/v1/workflows/resume", `{"actor": "jdoe"}`).Code)
+	})
+
+	t.Run("Select", func(t *testing.T) {
+		for selector, expected := range map[string][]string{
+			"env=prod":                            {"label_a", "label_b"},
+			"env=prod,tier!=batch":                {"label_a"},
+			"tier in (batch,web)":                 {"label_a", "label_b"},
+			"tier notin (batch)":                  {"label_a", "label_c"},
+			"example.com/cost-center":             {"label_c"},
+			"!tier":                               {"label_c"},
+			"env==dev,example.com/cost-center=42": {"label_c"},
+		} {
+			assert.Equal(t, expected, names("?like=label&selector="+url.QueryEscape(selector)), selector)
+		}
+		assert.Equal(t, []string{"label_a", "label_b", "label_c"}, names("?team=data"))
+		assert.Empty(t, names("?team=other"))
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		w := ct.send("PATCH", "/v1/workflow/label_a", `{"labels": {"tier": null, "owner": "jdoe"}}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response getWorkflowResp
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, model.Labels{"env": "prod", "owner": "jdoe"}, response.Labels)
+		assert.Equal(t, []string{"label_a", "label_c"}, names("?like=label&selector=!tier"))
+	})
+
+	t.Run("Bulk", func(t *testing.T) {
+		response := bulk("POST", "/v1/workflows/pause?selector=env%3Dprod", `{"actor": "jdoe", "reason": "outage"}`)
+		assert.Equal(t, []string{"label_a", "label_b"}, response.Workflows)
+		assert.Empty(t, response.Errors)
+		var paused []table.Workflow
+		mockDB.Where("paused_by = ?", "jdoe").Order("name").Find(&paused)
+		assert.Equal(t, 2, len(paused))
+		assert.False(t, paused[0].IsActive)
+
+		response = bulk("POST", "/v1/workflows/resume?selector=tier%3Dbatch", `{"actor": "jdoe"}`)
+		assert.Equal(t, []string{"label_b"}, response.Workflows)
+		var wf table.Workflow
+		mockDB.Where("name = ?", "label_b").First(&wf)
+		assert.True(t, wf.IsActive)
+		assert.Nil(t, wf.PausedAt)
+
+		// label_b is not paused anymore
+		response = bulk("POST", "/v1/workflows/resume?selector=env%3Dprod", `{"actor": "jdoe"}`)
+		assert.Equal(t, []string{"label_a"}, response.Workflows)
+		assert.Equal(t, map[string]string{"label_b": errWorkflowNotPaused.Error()}, response.Errors)
+
+		response = bulk("DELETE", "/v1/workflows?selector=env%3Ddev", "")
+		assert.Equal(t, []string{"label_c"}, response.Workflows)
+		assert.Equal(t, []string{"label_a", "label_b"}, names("?like=label"))
+	})
+
+	ct.cleanup()
+}
+
+func TestGetWorkflowsFilters(t *testing.T) {
+	ct := newControlTest(nil)
+
+	type page struct {
+		Data       []getWorkflowResp `json:"data"`
+		Pagination struct {
+			Total      *int64  `json:"total"`
+			NextCursor *string `json:"nextCursor"`
+		} `json:"pagination"`
+	}
+	get := func(query string) (int, page) {
+		req, _ := http.NewRequest("GET", "/v1/workflows"+query, nil)
+		w := httptest.NewRecorder()
+		ct.router.ServeHTTP(w, req)
+		var response page
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	names := func(query string) []string {
+		code, response := get(query)
+		assert.Equal(t, http.StatusOK, code, query)
+		names := []string{}
+		for _, workflow := range response.Data {
+			names = append(names, workflow.Name)
+		}
+		return names
+	}
+
+	owner := "team@example.com"
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, wf := range []table.Workflow{
+		{Name: "filter_a", Artifact: "s3://bucket/a.jar", Every: model.Every{Quantity: 1, Unit: model.EveryHour}, NextRuntime: now.Add(-time.Hour), IsActive: true, Owner: &owner},
+		{Name: "filter_b", Artifact: "s3://bucket/b.jar", Every: model.Every{Quantity: 2, Unit: model.EveryHour}, NextRuntime: now.Add(time.Hour), IsActive: true},
+		{Name: "filter_c", Artifact: "s3://other_bucket/c.jar", Every: model.Every{Quantity: 1, Unit: model.EveryDay}, NextRuntime: now.Add(-time.Hour), IsActive: false},
+	} {
+		wf.Command = "java -jar test.jar"
+		assert.NoError(t, ct.db.Create(&wf).Error)
+		for j, status := range []string{Failed.ToString(), Finished.ToString()}[:i%2+1] {
+			scheduled := now.Add(time.Duration(j-2) * time.Hour)
+			assert.NoError(t, ct.db.Create(&table.ScheduledWorkflow{WorkflowID: wf.ID, StartTime: scheduled, ScheduledStartTime: scheduled, Status: status}).Error)
+		}
+	}
+
+	t.Run("Filters", func(t *testing.T) {
+		before := url.QueryEscape(now.Format(time.RFC3339))
+		for query, expected := range map[string][]string{
+			"isActive=true":                                            {"filter_a", "filter_b"},
+			"isActive=false":                                           {"filter_c"},
+			"everyUnit=hour":                                           {"filter_a", "filter_b"},
+			"everyUnit=cron":                                           {},
+			"owner=team%40example.com":                                 {"filter_a"},
+			"artifactPrefix=s3://bucket/":                              {"filter_a", "filter_b"},
+			"artifactPrefix=s3://other_":                               {"filter_c"},
+			"artifactPrefix=s3://other%25":                             {},
+			"nextRuntimeBefore=" + before:                              {"filter_a", "filter_c"},
+			"nextRuntimeAfter=" + before:                               {"filter_b"},
+			"lastRunStatus=failed":                                     {"filter_a", "filter_c"},
+			"lastRunStatus=finished,timeout":                           {"filter_b"},
+			"isActive=true&everyUnit=hour&nextRuntimeBefore=" + before: {"filter_a"},
+		} {
+			assert.Equal(t, expected, names("?like=filter&"+query), query)
+		}
+	})
+
+	t.Run("Invalid filters", func(t *testing.T) {
+		for _, query := range []string{
+			"isActive=maybe",
+			"everyUnit=fortnight",
+			"nextRuntimeBefore=yesterday",
+			"lastRunStatus=failed,lost",
+			"cursor=garbage",
+			"cursor=&page=2",
+			"cursor=&orderBy=owner",
+		} {
+			code, _ := get("?" + query)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+		}
+	})
+
+	t.Run("Cursor", func(t *testing.T) {
+		for _, order := range []string{"orderBy=name&orderDir=desc", "orderBy=nextRuntime"} {
+			seen := []string{}
+			code, response := get("?like=filter&limit=2&cursor=&" + order)
+			for {
+				assert.Equal(t, http.StatusOK, code)
+				assert.Nil(t, response.Pagination.Total)
+				for _, workflow := range response.Data {
+					seen = append(seen, workflow.Name)
+				}
+				if response.Pagination.NextCursor == nil {
+					break
+				}
+				code, response = get("?like=filter&limit=2&cursor=" + *response.Pagination.NextCursor + "&" + order)
+			}
+			assert.ElementsMatch(t, []string{"filter_a", "filter_b", "filter_c"}, seen, order)
+			assert.Equal(t, 3, len(seen), order)
+		}
+		assert.Equal(t, []string{"filter_c", "filter_b", "filter_a"}, names("?like=filter&orderDir=desc"))
+
+		code, _ := get("?like=filter&limit=2&cursor=" + newWorkflowCursor("name", "asc", table.Workflow{Name: "filter_a"}) + "&orderDir=desc")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	ct.cleanup()
+}
+
+func TestRestartRunCount(t *testing.T) {
+	ct := newControlTest(nil)
+	body := putWorkflowReq{
+		Name:        "run_count_test",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       "1.day",
+		NextRuntime: staticNextRuntime(),
+		MaxRuns:     2,
+		IsActive:    true,
+	}
+	jsonBody, _ := json.Marshal(body)
+	assert.Equal(t, http.StatusOK, ct.send("PUT", "/v1/workflow", string(jsonBody)).Code)
+	runCount := func() uint {
+		var wf table.Workflow
+		ct.db.Where("name = ?", body.Name).First(&wf)
+		return wf.RunCount
+	}
+
+	t.Run("Reactivating a workflow past its max runs restarts them", func(t *testing.T) {
+		// deactivated by the scheduler after its last run
+		ct.db.Model(&table.Workflow{}).Where("name = ?", body.Name).
+			Updates(map[string]interface{}{"run_count": 2, "is_active": false, "next_runtime": staticNextRuntime().Add(48 * time.Hour)})
+		assert.Equal(t, http.StatusOK, ct.send("PUT", "/v1/workflow", string(jsonBody)).Code)
+		assert.Equal(t, uint(0), runCount())
+	})
+
+	t.Run("Other changes keep the run count", func(t *testing.T) {
+		ct.db.Model(&table.Workflow{}).Where("name = ?", body.Name).Update("run_count", 1)
+		assert.Equal(t, http.StatusOK, ct.send("PUT", "/v1/workflow", string(jsonBody)).Code)
+		assert.Equal(t, http.StatusOK, ct.send("PATCH", "/v1/workflow/"+body.Name, `{"command": "java -jar test2.jar"}`).Code)
+		assert.Equal(t, uint(1), runCount())
+	})
+
+	t.Run("Changing the max runs or next runtime restarts them", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, ct.send("PATCH", "/v1/workflow/"+body.Name, `{"maxRuns": 3}`).Code)
+		assert.Equal(t, uint(0), runCount())
+
+		ct.db.Model(&table.Workflow{}).Where("name = ?", body.Name).Update("run_count", 1)
+		nextRuntime, _ := json.Marshal(staticNextRuntime().Add(24 * time.Hour))
+		assert.Equal(t, http.StatusOK, ct.send("PATCH", "/v1/workflow/"+body.Name, fmt.Sprintf(`{"nextRuntime": %s}`, nextRuntime)).Code)
+		assert.Equal(t, uint(0), runCount())
+	})
+
+	ct.cleanup()
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/metrics"
+)
+
+// workflow version actions
+const (
+	versionPut      = "put"
+	versionPatch    = "patch"
+	versionDelete   = "delete"
+	versionRollback = "rollback"
+	versionRestore  = "restore"
+)
+
+// rollbackColumns are the definition columns a rollback restores, the
+// schedule progress and activation are left alone
+var rollbackColumns = []string{"artifact", "command", "every", "backfill", "owner", "schedule_delay_minutes", "timezone", "end_time", "max_runs", "misfire_policy", "misfire_last_n", "max_catch_up_minutes", "overlap_policy", "dependency_timeout_minutes", "parameters", "template_command", "team"}
+
+type versionResp struct {
+	Version    uint           `json:"version"`
+	Action     string         `json:"action"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	Definition putWorkflowReq `json:"definition"`
+}
+
+// recordVersion appends the current definition of wf to its versions
+func recordVersion(tx *gorm.DB, wf table.Workflow, action string) error {
+	var snapshot table.Workflow
+	err := preloadDefinition(tx.Unscoped()).First(&snapshot, wf.ID).Error
+	if err != nil {
+		return err
+	}
+	definition, err := json.Marshal(workflowDefinition(snapshot))
+	if err != nil {
+		return err
+	}
+	return tx.Create(&table.WorkflowVersion{
+		WorkflowID: snapshot.ID,
+		Version:    snapshot.Version,
+		Action:     action,
+		Definition: string(definition),
+	}).Error
+}
+
+func versionResponse(version table.WorkflowVersion) versionResp {
+	var definition putWorkflowReq
+	if err := json.Unmarshal([]byte(version.Definition), &definition); err != nil {
+		fmt.Printf("[warning] invalid definition of workflow version (workflow_id: %d, version: %d): %s\n", version.WorkflowID, version.Version, err)
+	}
+	definition.Parameters = definition.Parameters.Redacted()
+	return versionResp{
+		Version:    version.Version,
+		Action:     version.Action,
+		CreatedAt:  version.CreatedAt,
+		Definition: definition,
+	}
+}
+
+// getWorkflowVersions handles GET /v1/workflow/:name/versions, latest first,
+// the history of a deleted workflow is kept
+// Query parameters:
+//   - page: page number (default: 1)
+//   - limit: items per page (default: 50)
+func (ctrl *Control) getWorkflowVersions(c *gin.Context) {
+	start := time.Now()
+	name := c.Param("name")
+
+	var wf table.Workflow
+	if ctrl.db.Unscoped().Where("name = ?", name).Limit(1).Find(&wf).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	query := ctrl.db.Model(&table.WorkflowVersion{}).Where("workflow_id = ?", wf.ID)
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	var versions []table.WorkflowVersion
+	result := query.WithContext(ctx).
+		Order("version desc").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&versions)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	response := []versionResp{}
+	for _, version := range versions {
+		response = append(response, versionResponse(version))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":       response,
+		"pagination": paginationResponse(total, page, limit),
+	})
+
+	metrics.UpdateHistogram("http_request_duration_seconds", time.Since(start), map[string]string{"route": "get_workflow_versions"})
+	metrics.IncrementCounter("http_requests_total", map[string]string{"route": "get_workflow_versions"})
+}
+
+// rollbackWorkflow handles POST /v1/workflow/:name/rollback?version=N, the
+// definition of version N becomes a new version
+func (ctrl *Control) rollbackWorkflow(c *gin.Context) {
+	name := c.Param("name")
+	versionNumber, err := strconv.ParseUint(c.Query("version"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_version",
+			Code:    "400",
+			Message: "version must be a positive integer",
+		})
+		return
+	}
+	expected, ok := ctrl.ifMatchVersion(c, name)
+	if !ok {
+		return
+	}
+
+	var current table.Workflow
+	if ctrl.db.Where("name = ?", name).Limit(1).Find(&current).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Workflow not found:": fmt.Sprintf("name=%s", name)})
+		return
+	}
+	var version table.WorkflowVersion
+	if ctrl.db.Where("workflow_id = ? and version = ?", current.ID, versionNumber).Limit(1).Find(&version).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"Version not found:": fmt.Sprintf("name=%s, version=%d", name, versionNumber)})
+		return
+	}
+	if expected == nil {
+		expected = &current.Version
+	}
+
+	var body putWorkflowReq
+	if err := json.Unmarshal([]byte(version.Definition), &body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"name": name, "error": err.Error()})
+		return
+	}
+	body.NextRuntime = current.NextRuntime
+	wf, associations, err := ctrl.workflowFromReq(body)
+	if err != nil {
+		// e.g. a calendar deleted since
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	columns := restartRunCount(current, wf, slices.Clone(rollbackColumns))
+	wf, err = ctrl.saveWorkflow(wf, columns, expected, associations, versionRollback)
+	if !ctrl.savedWorkflow(c, name, err) {
+		return
+	}
+	fmt.Printf("workflow (name: %s) rolled back to version %d as version %d\n", name, versionNumber, wf.Version)
+	c.Header("ETag", workflowETag(wf))
+	c.IndentedJSON(http.StatusOK, ctrl.reloadWorkflow(wf))
+}
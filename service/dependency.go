@@ -0,0 +1,144 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/orchard"
+)
+
+// outcome of the upstream runs of a run
+type upstreamOutcome int
+
+const (
+	upstreamsPending upstreamOutcome = iota
+	upstreamsSucceeded
+	upstreamsFailed
+	upstreamsSkipped
+)
+
+// upstreamPollInterval is how often the status of an activated upstream run
+// is polled in orchard when the reconciler, which records it, is disabled
+const upstreamPollInterval = time.Minute
+
+// checkUpstreams tells whether the latest run of every upstream of wf at the
+// scheduled time of swf has succeeded, along with the reason when one of
+// them failed or was skipped. A manual or backfill rerun of the slot
+// replaces the earlier runs. The outcome of activated runs is the one
+// recorded by the reconciler.
+func (s *Scheduler) checkUpstreams(
+	db *gorm.DB,
+	client *orchard.OrchardRestClient,
+	wf table.Workflow,
+	swf table.ScheduledWorkflow,
+) (upstreamOutcome, string) {
+	slot := swf.ScheduledStartTime
+	outcome := upstreamsSucceeded
+	for _, upstream := range wf.Upstreams {
+		var runs []table.ScheduledWorkflow
+		db.Where("workflow_id = ? and (scheduled_start_time = ? or (status = ? and scheduled_start_time <= ? and skipped_until >= ?))",
+			upstream.ID, slot, Skipped.ToString(), slot, slot).
+			Order("start_time desc, id desc").
+			Find(&runs)
+		var skipped *table.ScheduledWorkflow
+		var latest *table.ScheduledWorkflow
+		scheduled := 0
+		for i, run := range runs {
+			if run.Status == Skipped.ToString() {
+				skipped = &runs[i]
+				continue
+			}
+			if latest == nil {
+				latest = &runs[i]
+			}
+			// a rerun of the slot replaces the earlier runs
+			if run.ID != latest.ID && (run.RunID == "" || run.RunID != latest.RunID) {
+				continue
+			}
+			scheduled++
+			status := run.Status
+			if status == Activated.ToString() {
+				status = s.pollUpstream(client, run)
+			}
+			switch status {
+			case Finished.ToString():
+			case Created.ToString(), Activated.ToString(), Queued.ToString():
+				outcome = upstreamsPending
+			default:
+				return upstreamsFailed, fmt.Sprintf("upstream %s run (orchard_id: %s) %s", upstream.Name, run.OrchardID, status)
+			}
+		}
+		if scheduled > 0 {
+			continue
+		}
+		if skipped != nil {
+			// the slot won't run upstream, no need to wait it out
+			return upstreamsSkipped, fmt.Sprintf("upstream %s run skipped: %s", upstream.Name, skipped.Reason)
+		}
+		// not scheduled yet
+		outcome = upstreamsPending
+	}
+	return outcome, ""
+}
+
+// pollUpstream returns the status of an activated upstream run. Without the
+// reconciler it is polled in orchard at most every upstreamPollInterval.
+func (s *Scheduler) pollUpstream(client *orchard.OrchardRestClient, run table.ScheduledWorkflow) string {
+	if s.ReconcileInterval > 0 {
+		return run.Status
+	}
+	if polled, ok := s.upstreamPolls.Load(run.ID); ok && time.Since(polled.(time.Time)) < upstreamPollInterval {
+		return run.Status
+	}
+	s.upstreamPolls.Store(run.ID, time.Now())
+	details, err := client.Details(run.OrchardID)
+	if err != nil {
+		fmt.Printf("[warning] error getting workflow details (orchard_id: %s): %s\n", run.OrchardID, err)
+		return run.Status
+	}
+	if !details.IsTerminal() {
+		return run.Status
+	}
+	s.upstreamPolls.Delete(run.ID)
+	return terminalStatus(details.Status).ToString()
+}
+
+func (s *Scheduler) dependencyTimeout(wf table.Workflow) time.Duration {
+	if wf.DependencyTimeoutMinutes > 0 {
+		return time.Duration(wf.DependencyTimeoutMinutes) * time.Minute
+	}
+	return s.DependencyTimeout
+}
+
+// failUpstream gives up on a run whose upstream runs won't succeed, the
+// orchard workflow that was never activated is deleted. The run is skipped
+// along with a skipped upstream run, otherwise it fails and the owner is
+// notified.
+func (s *Scheduler) failUpstream(
+	db *gorm.DB,
+	client *orchard.OrchardRestClient,
+	wf table.Workflow,
+	swf table.ScheduledWorkflow,
+	status ScheduleStatus,
+	reason string,
+) {
+	fmt.Printf("[error] not activating workflow (name: %s, orchard_id: %s): %s\n", wf.Name, swf.OrchardID, reason)
+	if err := client.Delete(swf.OrchardID); err != nil {
+		fmt.Printf("[error] error deleting workflow (orchard_id: %s): %s\n", swf.OrchardID, err)
+	}
+	db.Model(&swf).Updates(map[string]interface{}{
+		"status": status.ToString(),
+		"reason": reason,
+	})
+	if status == UpstreamFailed {
+		notifyOwner(wf, errors.New(reason))
+	}
+}
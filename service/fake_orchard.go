@@ -67,9 +67,50 @@ func (o *FakeOrchard) activateWorkflow(c *gin.Context) {
 	}
 }
 
+func (o *FakeOrchard) cancelWorkflow(c *gin.Context) {
+	o.setStatus(c, "canceled")
+}
+
+func (o *FakeOrchard) deleteWorkflow(c *gin.Context) {
+	o.setStatus(c, "deleted")
+}
+
+func (o *FakeOrchard) setStatus(c *gin.Context, status string) {
+	orchardId := c.Param("id")
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if nameSts, ok := o.Workflows[orchardId]; ok {
+		o.Workflows[orchardId] = WorkflowStatus{
+			name:   nameSts.name,
+			status: status,
+		}
+		c.JSON(http.StatusOK, orchardId)
+	} else {
+		c.JSON(http.StatusNotFound, "not exist")
+	}
+}
+
+func (o *FakeOrchard) workflowDetails(c *gin.Context) {
+	orchardId := c.Param("id")
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if nameSts, ok := o.Workflows[orchardId]; ok {
+		c.JSON(http.StatusOK, gin.H{
+			"id":     orchardId,
+			"name":   nameSts.name,
+			"status": nameSts.status,
+		})
+	} else {
+		c.JSON(http.StatusNotFound, "not exist")
+	}
+}
+
 func (o *FakeOrchard) Run() {
 	r := gin.Default()
 	r.POST("v1/workflow", o.postWorkflow)
 	r.PUT("v1/workflow/:id/activate", o.activateWorkflow)
+	r.PUT("v1/workflow/:id/cancel", o.cancelWorkflow)
+	r.DELETE("v1/workflow/:id", o.deleteWorkflow)
+	r.GET("v1/workflow/:id/details", o.workflowDetails)
 	r.Run(o.address)
 }
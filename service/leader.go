@@ -0,0 +1,152 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"mce.salesforce.com/sprinkler/database"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/metrics"
+)
+
+// leaderName is the lease row the scheduler replicas campaign for
+const leaderName = "scheduler"
+
+const defaultLeaderLease = 30 * time.Second
+
+func init() {
+	metrics.AddGauge("scheduler_leader", "Whether this scheduler is the leader running the singleton duties", []string{})
+}
+
+type leaderStatus struct {
+	Holder     string     `json:"holder"`
+	AcquiredAt *time.Time `json:"acquiredAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	IsLeader   bool       `json:"isLeader"`
+}
+
+// instanceID identifies this scheduler replica as a leader
+func (s *Scheduler) instanceID() string {
+	s.instanceOnce.Do(func() {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "scheduler"
+		}
+		s.instance = fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+	})
+	return s.instance
+}
+
+func (s *Scheduler) leaderLease() time.Duration {
+	if s.LeaderLease <= 0 {
+		return defaultLeaderLease
+	}
+	return s.LeaderLease
+}
+
+// isLeader reports whether this scheduler runs the singleton duties: the
+// cleanup sweep, reconciliation and resuming paused workflows
+func (s *Scheduler) isLeader() bool {
+	return s.leading.Load()
+}
+
+func (s *Scheduler) startLeaderElection(ctx context.Context) {
+	s.elect(database.GetInstance())
+	every(ctx, s.leaderLease()/3, func() {
+		s.elect(database.GetInstance())
+	})
+}
+
+// elect campaigns for the leadership and records the outcome
+func (s *Scheduler) elect(db *gorm.DB) {
+	leading := s.campaign(db)
+	if leading != s.leading.Swap(leading) {
+		if leading {
+			fmt.Printf("scheduler (instance: %s) became the leader\n", s.instanceID())
+		} else {
+			fmt.Printf("[warning] scheduler (instance: %s) lost the leadership\n", s.instanceID())
+		}
+	}
+	value := 0.0
+	if leading {
+		value = 1
+	}
+	metrics.SetGauge("scheduler_leader", value, map[string]string{})
+
+	var leader table.SchedulerLeader
+	if db.Where("name = ?", leaderName).Limit(1).Find(&leader).RowsAffected == 1 {
+		s.leaderMu.Lock()
+		s.leader = leader
+		s.leaderMu.Unlock()
+	}
+}
+
+// campaign renews the leader lease held by this scheduler, or takes it if it
+// expired or was never taken, reporting whether this scheduler leads
+func (s *Scheduler) campaign(db *gorm.DB) bool {
+	now := time.Now()
+	expiresAt := now.Add(s.leaderLease())
+
+	result := db.Model(&table.SchedulerLeader{}).
+		Where("name = ? and holder = ? and expires_at >= ?", leaderName, s.instanceID(), now).
+		Update("expires_at", expiresAt)
+	if result.Error == nil && result.RowsAffected == 1 {
+		return true
+	}
+
+	result = db.Model(&table.SchedulerLeader{}).
+		Where("name = ? and expires_at < ?", leaderName, now).
+		UpdateColumns(map[string]interface{}{
+			"holder":      s.instanceID(),
+			"acquired_at": now,
+			"expires_at":  expiresAt,
+		})
+	if result.Error != nil {
+		fmt.Printf("[error] error campaigning for the scheduler leadership: %s\n", result.Error)
+		return false
+	}
+	if result.RowsAffected == 1 {
+		return true
+	}
+
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&table.SchedulerLeader{
+		Name:       leaderName,
+		Holder:     s.instanceID(),
+		AcquiredAt: now,
+		ExpiresAt:  expiresAt,
+	})
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// resign hands the leadership over to the other schedulers right away
+func (s *Scheduler) resign(db *gorm.DB) {
+	if !s.leading.Swap(false) {
+		return
+	}
+	db.Where("name = ? and holder = ?", leaderName, s.instanceID()).Delete(&table.SchedulerLeader{})
+	metrics.SetGauge("scheduler_leader", 0, map[string]string{})
+	fmt.Printf("scheduler (instance: %s) resigned the leadership\n", s.instanceID())
+}
+
+// leaderStatus is the leader last seen by this scheduler
+func (s *Scheduler) leaderStatus() leaderStatus {
+	s.leaderMu.Lock()
+	defer s.leaderMu.Unlock()
+	status := leaderStatus{IsLeader: s.isLeader()}
+	if leader := s.leader; leader.Holder != "" {
+		status.Holder = leader.Holder
+		status.AcquiredAt = &leader.AcquiredAt
+		status.ExpiresAt = &leader.ExpiresAt
+	}
+	return status
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+func TestLeaderElection(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	first := &Scheduler{LeaderLease: time.Minute}
+	second := &Scheduler{LeaderLease: time.Minute}
+
+	t.Run("A single scheduler leads", func(t *testing.T) {
+		first.elect(mockDB)
+		second.elect(mockDB)
+		assert.True(t, first.isLeader())
+		assert.False(t, second.isLeader())
+
+		// renewed by the leader
+		first.elect(mockDB)
+		second.elect(mockDB)
+		assert.True(t, first.isLeader())
+		assert.False(t, second.isLeader())
+		assert.Equal(t, first.instanceID(), second.leaderStatus().Holder)
+	})
+
+	t.Run("An expired leadership is taken over", func(t *testing.T) {
+		mockDB.Model(&table.SchedulerLeader{}).
+			Where("name = ?", leaderName).
+			Update("expires_at", time.Now().Add(-time.Second))
+		second.elect(mockDB)
+		first.elect(mockDB)
+		assert.True(t, second.isLeader())
+		assert.False(t, first.isLeader())
+
+		var leader table.SchedulerLeader
+		mockDB.Where("name = ?", leaderName).First(&leader)
+		assert.Equal(t, second.instanceID(), leader.Holder)
+	})
+
+	t.Run("The leader is in the status", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/__status", nil)
+		w := httptest.NewRecorder()
+		first.statusRouter().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Instance string       `json:"instance"`
+			Leader   leaderStatus `json:"leader"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, first.instanceID(), response.Instance)
+		assert.Equal(t, second.instanceID(), response.Leader.Holder)
+		assert.False(t, response.Leader.IsLeader)
+	})
+
+	cleanupDB(mockDB, dbName)
+}
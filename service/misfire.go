@@ -0,0 +1,131 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+// maxMisfireSlots bounds the slots planMisfire walks through at once, the
+// ones past it are planned on the next tick
+const maxMisfireSlots = 1000
+
+const defaultMisfireThreshold = 5 * time.Minute
+
+// skippedSlot sums up Count consecutive slots skipped for the same reason,
+// from ScheduledStartTime to Until
+type skippedSlot struct {
+	ScheduledStartTime time.Time
+	Until              time.Time
+	Count              int
+	Reason             string
+}
+
+// misfireThreshold is how late a slot is picked up before the misfire policy
+// applies, slots are always late by up to the scheduler interval
+func (s *Scheduler) misfireThreshold() time.Duration {
+	if s.MisfireThreshold <= 0 {
+		return defaultMisfireThreshold
+	}
+	return s.MisfireThreshold
+}
+
+// misfirePlan is what lockAndCreate does with the slots due for a workflow
+type misfirePlan struct {
+	run     []time.Time // oldest first
+	skipped []skippedSlot
+	next    time.Time
+}
+
+// skip adds slot to the skipped slots, along with the previous ones if they
+// were skipped for the same reason
+func (plan *misfirePlan) skip(slot time.Time, reason string) {
+	if n := len(plan.skipped); n > 0 && plan.skipped[n-1].Reason == reason {
+		plan.skipped[n-1].Until = slot
+		plan.skipped[n-1].Count++
+		return
+	}
+	plan.skipped = append(plan.skipped, skippedSlot{ScheduledStartTime: slot, Until: slot, Count: 1, Reason: reason})
+}
+
+// planMisfire splits the slots due at now, starting at wf.NextRuntime, into
+// the ones to run and the ones to skip. A slot late by more than threshold is
+// missed: past the max catch-up age it is always skipped, otherwise the
+// workflow misfire policy decides. Slots on time always run. After a long
+// outage the missed slots are planned maxMisfireSlots at a time.
+func planMisfire(wf table.Workflow, now time.Time, threshold time.Duration) misfirePlan {
+	policy := model.MisfirePolicyOf(wf.MisfirePolicy, wf.Backfill)
+	maxAge := time.Duration(wf.MaxCatchUpMinutes) * time.Minute
+	loc := workflowLocation(wf)
+	step := func(slot time.Time) time.Time {
+		return addInterval(slot.In(loc), wf.Every, wf.ScheduleAnchor)
+	}
+
+	keep := 0
+	switch policy {
+	case model.MisfireFireOnceNow:
+		keep = 1
+	case model.MisfireFireLastN:
+		keep = int(wf.MisfireLastN)
+	}
+
+	plan := misfirePlan{}
+	var missed []time.Time
+	slot := wf.NextRuntime
+	truncated := false
+	for walked := 0; !slot.IsZero() && !slot.After(now); walked++ {
+		if walked == maxMisfireSlots+keep {
+			truncated = true
+			break
+		}
+		late := now.Sub(slot)
+		switch {
+		case late <= threshold:
+			plan.run = append(plan.run, slot)
+		case maxAge > 0 && late > maxAge:
+			plan.skip(slot, fmt.Sprintf("missed by more than the max catch-up age of %d minutes", wf.MaxCatchUpMinutes))
+		case policy == model.MisfireFireAll:
+			// missed slots are replayed one per scheduler tick
+			plan.run = append(plan.run, slot)
+			plan.next = step(slot)
+			return plan
+		default:
+			missed = append(missed, slot)
+		}
+		slot = step(slot)
+	}
+	plan.next = slot
+
+	if keep > len(missed) {
+		keep = len(missed)
+	}
+	for _, s := range missed[:len(missed)-keep] {
+		plan.skip(s, fmt.Sprintf("missed, misfire policy %s", policy))
+	}
+	if truncated {
+		// later slots were missed too, the kept ones are planned again with them
+		if keep > 0 {
+			plan.next = missed[len(missed)-keep]
+		}
+		return plan
+	}
+	plan.run = append(missed[len(missed)-keep:], plan.run...)
+	return plan
+}
+
+// workflowLocation is the time zone the workflow schedule is evaluated in
+func workflowLocation(wf table.Workflow) *time.Location {
+	loc, err := model.LoadTimezone(wf.Timezone)
+	if err != nil {
+		fmt.Printf("[warning] %s, falling back to UTC (name: %s)\n", err, wf.Name)
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+func TestPlanMisfire(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 2, 0, 0, time.UTC)
+	// hourly slots from 08:00, the 12:00 one is on time
+	hourly := func(policy model.MisfirePolicy) table.Workflow {
+		return table.Workflow{
+			Every:         model.Every{Quantity: 1, Unit: model.EveryHour},
+			NextRuntime:   time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+			MisfirePolicy: policy,
+		}
+	}
+	at := func(hour int) time.Time {
+		return time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC)
+	}
+	// the first and last slot of each skipped summary
+	skippedAt := func(plan misfirePlan) [][2]time.Time {
+		slots := [][2]time.Time{}
+		for _, s := range plan.skipped {
+			slots = append(slots, [2]time.Time{s.ScheduledStartTime, s.Until})
+		}
+		return slots
+	}
+
+	t.Run("fire_all replays one missed slot per tick", func(t *testing.T) {
+		plan := planMisfire(hourly(model.MisfireFireAll), now, 5*time.Minute)
+		assert.Equal(t, []time.Time{at(8)}, plan.run)
+		assert.Empty(t, plan.skipped)
+		assert.Equal(t, at(9), plan.next)
+	})
+
+	t.Run("fire_once_now runs the latest missed slot", func(t *testing.T) {
+		plan := planMisfire(hourly(model.MisfireFireOnceNow), now, 5*time.Minute)
+		assert.Equal(t, []time.Time{at(11), at(12)}, plan.run)
+		assert.Equal(t, [][2]time.Time{{at(8), at(10)}}, skippedAt(plan))
+		assert.Equal(t, 3, plan.skipped[0].Count)
+		assert.Equal(t, at(13), plan.next)
+	})
+
+	t.Run("skip runs only the slot on time", func(t *testing.T) {
+		plan := planMisfire(hourly(model.MisfireSkip), now, 5*time.Minute)
+		assert.Equal(t, []time.Time{at(12)}, plan.run)
+		assert.Equal(t, [][2]time.Time{{at(8), at(11)}}, skippedAt(plan))
+		assert.Equal(t, at(13), plan.next)
+	})
+
+	t.Run("fire_last_n runs the N latest missed slots", func(t *testing.T) {
+		wf := hourly(model.MisfireFireLastN)
+		wf.MisfireLastN = 2
+		plan := planMisfire(wf, now, 5*time.Minute)
+		assert.Equal(t, []time.Time{at(10), at(11), at(12)}, plan.run)
+		assert.Equal(t, [][2]time.Time{{at(8), at(9)}}, skippedAt(plan))
+	})
+
+	t.Run("Max catch-up age applies to fire_all", func(t *testing.T) {
+		wf := hourly(model.MisfireFireAll)
+		wf.MaxCatchUpMinutes = 150
+		plan := planMisfire(wf, now, 5*time.Minute)
+		assert.Equal(t, []time.Time{at(10)}, plan.run)
+		assert.Equal(t, [][2]time.Time{{at(8), at(9)}}, skippedAt(plan))
+		assert.Contains(t, plan.skipped[0].Reason, "max catch-up age")
+		assert.Equal(t, at(11), plan.next)
+	})
+
+	t.Run("Legacy backfill flag", func(t *testing.T) {
+		wf := hourly("")
+		wf.Backfill = true
+		assert.Equal(t, []time.Time{at(8)}, planMisfire(wf, now, 5*time.Minute).run)
+		wf.Backfill = false
+		assert.Equal(t, []time.Time{at(11), at(12)}, planMisfire(wf, now, 5*time.Minute).run)
+	})
+
+	t.Run("Long outages are planned a bounded number of slots at a time", func(t *testing.T) {
+		minutely := hourly(model.MisfireFireOnceNow)
+		minutely.Every = model.Every{Quantity: 1, Unit: model.EveryMinute}
+		minutely.NextRuntime = now.Add(-24 * time.Hour)
+
+		plan := planMisfire(minutely, now, 5*time.Minute)
+		assert.Empty(t, plan.run)
+		assert.Equal(t, 1, len(plan.skipped))
+		assert.Equal(t, maxMisfireSlots, plan.skipped[0].Count)
+		// the latest slot walked is kept for the next tick
+		assert.Equal(t, minutely.NextRuntime.Add(maxMisfireSlots*time.Minute), plan.next)
+
+		for plan.next.Before(now.Add(-5 * time.Minute)) {
+			minutely.NextRuntime = plan.next
+			plan = planMisfire(minutely, now, 5*time.Minute)
+		}
+		assert.Equal(t, 7, len(plan.run), "the latest missed slot and the ones on time")
+		assert.Equal(t, now.Add(-6*time.Minute), plan.run[0])
+	})
+}
+
+func TestLockAndCreateMisfireSkip(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	// the default misfire threshold
+	scheduler := &Scheduler{}
+
+	// three slots missed and the next one in the future
+	slot := time.Now().UTC().Add(-3*time.Hour - 30*time.Minute).Truncate(time.Second)
+	wf := table.Workflow{
+		Name:          "misfire_skip_test",
+		Artifact:      "test.jar",
+		Command:       "java -jar test.jar",
+		Every:         model.Every{Quantity: 1, Unit: model.EveryHour},
+		NextRuntime:   slot,
+		IsActive:      true,
+		MisfirePolicy: model.MisfireSkip,
+	}
+	assert.NoError(t, mockDB.Create(&wf).Error)
+
+	scheduler.lockAndCreate(context.Background(), mockDB, wf)
+
+	var runs []table.ScheduledWorkflow
+	mockDB.Where("workflow_id = ?", wf.ID).Order("scheduled_start_time").Find(&runs)
+	// a single row sums up the skipped slots
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, Skipped.ToString(), runs[0].Status)
+	assert.Equal(t, uint(1), runs[0].WorkflowVersion)
+	assert.True(t, runs[0].ScheduledStartTime.Equal(slot))
+	assert.True(t, runs[0].SkippedUntil.Equal(slot.Add(3*time.Hour)))
+	assert.Contains(t, runs[0].Reason, "4 slots until")
+
+	var updated table.Workflow
+	mockDB.First(&updated, wf.ID)
+	assert.True(t, updated.NextRuntime.Equal(slot.Add(4*time.Hour)))
+	assert.Equal(t, uint(0), updated.RunCount)
+
+	cleanupDB(mockDB, dbName)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/orchard"
+)
+
+var errWorkflowNotPaused = errors.New("workflow is not paused")
+
+// pauseColumns hold the pause of a workflow, cleared when it is activated.
+// Who paused it and why are kept until the next pause.
+var pauseColumns = []string{"paused_at", "resume_at"}
+
+// workflowPause is who pauses a workflow, why and until when
+type workflowPause struct {
+	Actor         string
+	Reason        string
+	ResumeAt      *time.Time // paused until resumed through the control service if nil
+	CancelCreated bool       // delete the runs created but not activated yet
+}
+
+// workflowResume is who resumes a workflow and why
+type workflowResume struct {
+	Actor  string
+	Reason string
+}
+
+// pauseWorkflow deactivates wf and records the pause, the runs deleted from
+// orchard when pause.CancelCreated is set are returned
+func (s *Scheduler) pauseWorkflow(db *gorm.DB, wf table.Workflow, pause workflowPause) ([]table.ScheduledWorkflow, error) {
+	if pause.CancelCreated {
+		// no run is created while the created ones are deleted
+		token, ok := s.lockWorkflow(db, wf)
+		if !ok {
+			return nil, ErrWorkflowLocked
+		}
+		defer s.unlockWorkflow(db, wf, token)
+	}
+
+	err := db.Model(&wf).Updates(map[string]interface{}{
+		"is_active":    false,
+		"paused_at":    time.Now(),
+		"paused_by":    pause.Actor,
+		"pause_reason": pause.Reason,
+		"resume_at":    pause.ResumeAt,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("workflow (name: %s) paused by %s: %s\n", wf.Name, pause.Actor, pause.Reason)
+	if !pause.CancelCreated {
+		return nil, nil
+	}
+
+	var runs []table.ScheduledWorkflow
+	db.Where("workflow_id = ? and status = ?", wf.ID, Created.ToString()).Find(&runs)
+	client := &orchard.OrchardRestClient{
+		Host:       s.OrchardHost,
+		APIKeyName: s.OrchardAPIKeyName,
+		APIKey:     s.OrchardAPIKey,
+	}
+	for i, swf := range runs {
+		fmt.Printf("deleting workflow (name: %s, orchard_id: %s) of paused workflow\n", wf.Name, swf.OrchardID)
+		runs[i].Status = s.deleteWorkflows(client, []string{swf.OrchardID}, map[string]string{})[swf.OrchardID]
+		runs[i].Reason = "workflow paused"
+		result := db.Model(&runs[i]).
+			Where("status = ?", Created.ToString()).
+			Updates(map[string]interface{}{"status": runs[i].Status, "reason": runs[i].Reason})
+		if result.Error != nil {
+			return runs, result.Error
+		}
+	}
+	return runs, nil
+}
+
+// resumeWorkflow activates wf, ends its pause and records the resume, the
+// slots missed in the meantime follow the workflow misfire policy. A workflow
+// that is not paused is left as is.
+func resumeWorkflow(db *gorm.DB, wf table.Workflow, resume workflowResume) error {
+	result := db.Model(&wf).
+		Where("paused_at is not null").
+		Updates(map[string]interface{}{
+			"is_active":     true,
+			"paused_at":     nil,
+			"resume_at":     nil,
+			"resumed_at":    time.Now(),
+			"resumed_by":    resume.Actor,
+			"resume_reason": resume.Reason,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errWorkflowNotPaused
+	}
+	return nil
+}
+
+// resumeWorkflows resumes the paused workflows whose resume time is reached
+func (s *Scheduler) resumeWorkflows(db *gorm.DB) {
+	var workflows []table.Workflow
+	db.Where("paused_at is not null and resume_at <= ?", time.Now()).Find(&workflows)
+
+	for _, wf := range workflows {
+		resume := workflowResume{
+			Actor:  "scheduler",
+			Reason: fmt.Sprintf("resume time %s reached", wf.ResumeAt.Format(time.RFC3339)),
+		}
+		err := resumeWorkflow(db, wf, resume)
+		if errors.Is(err, errWorkflowNotPaused) {
+			// resumed through the control service in the meantime
+			continue
+		}
+		if err != nil {
+			fmt.Printf("[error] error resuming workflow (name: %s): %s\n", wf.Name, err)
+			continue
+		}
+		fmt.Printf("workflow (name: %s) resumed, paused by %s until %s\n", wf.Name, wf.PausedBy, wf.ResumeAt)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+func TestResumeWorkflows(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	scheduler := &Scheduler{}
+
+	var due, later table.Workflow
+	mockDB.Where("name = ?", getTestName).First(&due)
+	mockDB.Where("name = ?", deleteTestName).First(&later)
+	pastResume := time.Now().Add(-time.Minute)
+	futureResume := time.Now().Add(time.Hour)
+	_, err := scheduler.pauseWorkflow(mockDB, due, workflowPause{Actor: "ops", ResumeAt: &pastResume})
+	assert.NoError(t, err)
+	_, err = scheduler.pauseWorkflow(mockDB, later, workflowPause{Actor: "ops", ResumeAt: &futureResume})
+	assert.NoError(t, err)
+
+	scheduler.resumeWorkflows(mockDB)
+
+	mockDB.First(&due, due.ID)
+	assert.True(t, due.IsActive)
+	assert.Nil(t, due.PausedAt)
+	assert.Equal(t, "scheduler", due.ResumedBy)
+	assert.Contains(t, due.ResumeReason, "resume time")
+	assert.Equal(t, "ops", due.PausedBy)
+	mockDB.First(&later, later.ID)
+	assert.False(t, later.IsActive)
+	assert.NotNil(t, later.PausedAt)
+
+	cleanupDB(mockDB, dbName)
+}
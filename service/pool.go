@@ -0,0 +1,175 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mce.salesforce.com/sprinkler/metrics"
+)
+
+// worker pools of the scheduler
+const (
+	poolGeneration = "generation"
+	poolActivation = "activation"
+)
+
+func init() {
+	labels := []string{"pool"}
+	metrics.AddGauge("scheduler_queue_depth", "Number of tasks waiting for a worker", labels)
+	metrics.AddGauge("scheduler_workers_busy", "Number of workers running a task", labels)
+	metrics.AddGauge("scheduler_worker_utilization", "Ratio of the workers running a task", labels)
+	metrics.AddHistogram("scheduler_queue_wait_seconds", "Time tasks waited for a worker", labels)
+	metrics.AddCounter("scheduler_tasks_total", "Number of tasks run by the workers", labels)
+}
+
+type poolTask struct {
+	key      string
+	run      func(ctx context.Context)
+	queuedAt time.Time
+}
+
+// workerPool runs the tasks submitted to it on a fixed number of workers,
+// the others wait in a queue. A task is only queued once until it has run,
+// so rows picked up again on the next tick aren't processed twice. The tasks
+// are given a context canceled when the pool is stopped at its deadline.
+type workerPool struct {
+	name    string
+	size    int
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []poolTask
+	pending map[string]bool
+	busy    int
+	running sync.WaitGroup
+	stopped bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newWorkerPool(name string, size int) *workerPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &workerPool{
+		name:    name,
+		size:    size,
+		pending: map[string]bool{},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	p.updateMetrics()
+	return p
+}
+
+// submit queues run under key, unless a task with the same key is already
+// queued or running or the pool is stopped. It reports whether the task was
+// queued.
+func (p *workerPool) submit(key string, run func(ctx context.Context)) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped || p.pending[key] {
+		return false
+	}
+	p.pending[key] = true
+	p.queue = append(p.queue, poolTask{key: key, run: run, queuedAt: time.Now()})
+	p.updateMetricsLocked()
+	p.cond.Signal()
+	return true
+}
+
+func (p *workerPool) work() {
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.stopped {
+			p.cond.Wait()
+		}
+		if p.stopped {
+			p.mu.Unlock()
+			return
+		}
+		task := p.queue[0]
+		p.queue = p.queue[1:]
+		p.busy++
+		p.running.Add(1)
+		p.updateMetricsLocked()
+		p.mu.Unlock()
+		metrics.UpdateHistogram("scheduler_queue_wait_seconds", time.Since(task.queuedAt), map[string]string{"pool": p.name})
+
+		task.run(p.ctx)
+
+		p.mu.Lock()
+		p.busy--
+		delete(p.pending, task.key)
+		p.updateMetricsLocked()
+		p.mu.Unlock()
+		p.running.Done()
+		metrics.IncrementCounter("scheduler_tasks_total", map[string]string{"pool": p.name})
+	}
+}
+
+// stop drops the queued tasks, which haven't claimed anything yet, and waits
+// for the running ones until the deadline, when they are canceled. It reports
+// whether they all finished in time.
+func (p *workerPool) stop(deadline time.Time) bool {
+	p.mu.Lock()
+	p.stopped = true
+	for _, task := range p.queue {
+		delete(p.pending, task.key)
+	}
+	p.queue = nil
+	p.updateMetricsLocked()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	if p.wait(deadline) {
+		return true
+	}
+	p.cancel()
+	return false
+}
+
+// wait waits for the running tasks until the deadline, reporting whether
+// they all finished
+func (p *workerPool) wait(deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// stats returns the number of queued and running tasks
+func (p *workerPool) stats() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue), p.busy
+}
+
+func (p *workerPool) updateMetrics() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateMetricsLocked()
+}
+
+func (p *workerPool) updateMetricsLocked() {
+	labels := map[string]string{"pool": p.name}
+	metrics.SetGauge("scheduler_queue_depth", float64(len(p.queue)), labels)
+	metrics.SetGauge("scheduler_workers_busy", float64(p.busy), labels)
+	metrics.SetGauge("scheduler_worker_utilization", float64(p.busy)/float64(p.size), labels)
+}
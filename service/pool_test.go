@@ -0,0 +1,116 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool(t *testing.T) {
+	pool := newWorkerPool("test", 2)
+	release := make(chan struct{})
+	var running, maxRunning int32
+	var done sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		done.Add(1)
+		queued := pool.submit(fmt.Sprintf("task:%d", i), func(context.Context) {
+			defer done.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+		})
+		assert.True(t, queued)
+	}
+	assert.False(t, pool.submit("task:0", func(context.Context) {}), "a pending task is only queued once")
+
+	assert.Eventually(t, func() bool {
+		queued, busy := pool.stats()
+		return queued == 3 && busy == 2
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	done.Wait()
+	assert.Equal(t, int32(2), maxRunning)
+	assert.Eventually(t, func() bool {
+		queued, busy := pool.stats()
+		return queued == 0 && busy == 0
+	}, time.Second, 10*time.Millisecond)
+
+	ran := make(chan struct{})
+	assert.True(t, pool.submit("task:0", func(context.Context) { close(ran) }), "a task that ran can be queued again")
+	<-ran
+}
+
+func TestSchedulerPools(t *testing.T) {
+	scheduler := &Scheduler{MaxSize: 3, GenerationWorkers: 1}
+	generation, activation := scheduler.pools()
+	assert.Equal(t, 1, generation.size)
+	assert.Equal(t, 3, activation.size)
+
+	req, _ := http.NewRequest("GET", "/__status", nil)
+	w := httptest.NewRecorder()
+	scheduler.statusRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Pools map[string]poolStatus `json:"pools"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, poolStatus{Workers: 3}, response.Pools[poolActivation])
+}
+
+func TestWorkerPoolStop(t *testing.T) {
+	pool := newWorkerPool("test", 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var ran int32
+	pool.submit("running", func(context.Context) {
+		close(started)
+		<-release
+		atomic.AddInt32(&ran, 1)
+	})
+	<-started
+	pool.submit("queued", func(context.Context) { atomic.AddInt32(&ran, 1) })
+
+	assert.False(t, pool.stop(time.Now().Add(50*time.Millisecond)), "the running task is past the deadline")
+	queued, busy := pool.stats()
+	assert.Equal(t, 0, queued, "queued tasks are dropped")
+	assert.Equal(t, 1, busy)
+	assert.False(t, pool.submit("new", func(context.Context) {}), "a stopped pool takes no task")
+
+	close(release)
+	assert.True(t, pool.stop(time.Now().Add(time.Second)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ran))
+}
+
+func TestWorkerPoolCancel(t *testing.T) {
+	pool := newWorkerPool("test", 1)
+	started := make(chan struct{})
+	pool.submit("running", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	})
+	<-started
+
+	assert.False(t, pool.stop(time.Now().Add(50*time.Millisecond)), "the running task is past the deadline")
+	assert.True(t, pool.wait(time.Now().Add(time.Second)), "the running task stops once canceled")
+}
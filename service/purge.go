@@ -0,0 +1,107 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+// purgeReport is what a purge removed, or would remove in a dry run
+type purgeReport struct {
+	DryRun        bool      `json:"dryRun"`
+	DeletedBefore time.Time `json:"deletedBefore"`
+	Workflows     []string  `json:"workflows"`
+	Runs          int64     `json:"runs"`
+	Versions      int64     `json:"versions"`
+	Backfills     int64     `json:"backfills"`
+	Locks         int64     `json:"locks"`
+}
+
+// purgeWorkflows permanently removes the workflows deleted before
+// deletedBefore along with their runs, versions, backfills and locks
+func purgeWorkflows(db *gorm.DB, deletedBefore time.Time, dryRun bool) (purgeReport, error) {
+	report := purgeReport{DryRun: dryRun, DeletedBefore: deletedBefore, Workflows: []string{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var workflows []table.Workflow
+		err := tx.Unscoped().
+			Where("deleted_at IS NOT NULL and deleted_at < ?", deletedBefore).
+			Order("name").
+			Find(&workflows).Error
+		if err != nil || len(workflows) == 0 {
+			return err
+		}
+		ids := []uint{}
+		for _, wf := range workflows {
+			ids = append(ids, wf.ID)
+			report.Workflows = append(report.Workflows, wf.Name)
+		}
+
+		runIDs := tx.Unscoped().Model(&table.ScheduledWorkflow{}).Select("id").Where("workflow_id IN ?", ids)
+		counts := []struct {
+			count *int64
+			query *gorm.DB
+		}{
+			{&report.Runs, tx.Unscoped().Model(&table.ScheduledWorkflow{}).Where("workflow_id IN ?", ids)},
+			{&report.Versions, tx.Unscoped().Model(&table.WorkflowVersion{}).Where("workflow_id IN ?", ids)},
+			{&report.Backfills, tx.Unscoped().Model(&table.Backfill{}).Where("workflow_id IN ?", ids)},
+		}
+		for _, c := range counts {
+			if err := c.query.Count(c.count).Error; err != nil {
+				return err
+			}
+		}
+		var schedulerLocks, activatorLocks int64
+		if err := tx.Model(&table.WorkflowSchedulerLock{}).Where("workflow_id IN ?", ids).Count(&schedulerLocks).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&table.WorkflowActivatorLock{}).Where("scheduled_id IN (?)", runIDs).Count(&activatorLocks).Error; err != nil {
+			return err
+		}
+		report.Locks = schedulerLocks + activatorLocks
+		if dryRun {
+			return nil
+		}
+
+		deletes := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&table.WorkflowActivatorLock{}, "scheduled_id IN (?)", []interface{}{runIDs}},
+			{&table.WorkflowSchedulerLock{}, "workflow_id IN ?", []interface{}{ids}},
+			{&table.ScheduledWorkflow{}, "workflow_id IN ?", []interface{}{ids}},
+			{&table.Backfill{}, "workflow_id IN ?", []interface{}{ids}},
+			{&table.WorkflowVersion{}, "workflow_id IN ?", []interface{}{ids}},
+			{&table.WorkflowCalendar{}, "workflow_id IN ?", []interface{}{ids}},
+			{&table.WorkflowLabel{}, "workflow_id IN ?", []interface{}{ids}},
+			{&table.WorkflowDependency{}, "workflow_id IN ? or upstream_id IN ?", []interface{}{ids, ids}},
+			{&table.Workflow{}, "id IN ?", []interface{}{ids}},
+		}
+		for _, d := range deletes {
+			if err := tx.Unscoped().Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return purgeReport{DryRun: dryRun, DeletedBefore: deletedBefore, Workflows: []string{}}, err
+	}
+	return report, nil
+}
+
+func (r purgeReport) String() string {
+	verb := "purged"
+	if r.DryRun {
+		verb = "would purge"
+	}
+	return fmt.Sprintf("%s %d workflows deleted before %s (%d runs, %d versions, %d backfills, %d locks): %v",
+		verb, len(r.Workflows), r.DeletedBefore.Format(time.RFC3339), r.Runs, r.Versions, r.Backfills, r.Locks, r.Workflows)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"mce.salesforce.com/sprinkler/database"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/orchard"
+)
+
+func (s *Scheduler) startReconciler(ctx context.Context) {
+	if s.ReconcileInterval <= 0 {
+		return
+	}
+	every(ctx, s.ReconcileInterval, func() {
+		if s.isLeader() {
+			s.reconcileWorkflows(database.GetInstance())
+		}
+	})
+}
+
+// reconcileWorkflows records the outcome of the activated runs that are over
+// in orchard
+func (s *Scheduler) reconcileWorkflows(db *gorm.DB) {
+	var scheduledWorkflows []table.ScheduledWorkflow
+	db.Where("status = ?", Activated.ToString()).
+		Order("start_time").
+		Find(&scheduledWorkflows)
+
+	client := &orchard.OrchardRestClient{
+		Host:       s.OrchardHost,
+		APIKeyName: s.OrchardAPIKeyName,
+		APIKey:     s.OrchardAPIKey,
+	}
+	for _, swf := range scheduledWorkflows {
+		s.reconcileWorkflow(db, client, swf)
+	}
+}
+
+func (s *Scheduler) reconcileWorkflow(db *gorm.DB, client *orchard.OrchardRestClient, swf table.ScheduledWorkflow) {
+	var status ScheduleStatus
+	reason := ""
+	details, err := client.Details(swf.OrchardID)
+	switch {
+	case errors.Is(err, orchard.ErrNotFound):
+		status = Deleted
+		reason = "not found in orchard"
+	case err != nil:
+		fmt.Printf("[warning] error getting workflow details (orchard_id: %s): %s\n", swf.OrchardID, err)
+		return
+	case !details.IsTerminal():
+		return
+	default:
+		status = terminalStatus(details.Status)
+	}
+
+	completedAt := time.Now()
+	updates := map[string]interface{}{"status": status.ToString(), "completed_at": completedAt}
+	if reason != "" {
+		updates["reason"] = reason
+	}
+	if swf.ActivatedAt != nil {
+		updates["duration_seconds"] = int64(completedAt.Sub(*swf.ActivatedAt).Seconds())
+	}
+	// only the first scheduler to see the outcome records it and notifies
+	result := db.Model(&table.ScheduledWorkflow{}).
+		Where("id = ? and status = ?", swf.ID, Activated.ToString()).
+		Updates(updates)
+	if result.Error != nil {
+		fmt.Printf("[error] error recording workflow status (orchard_id: %s): %s\n", swf.OrchardID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	fmt.Printf("workflow (orchard_id: %s) %s\n", swf.OrchardID, status.ToString())
+
+	if status == Failed || status == TimedOut {
+		wf := table.Workflow{}
+		db.Unscoped().First(&wf, swf.WorkflowID)
+		notifyOwnerRunFailed(wf, swf, status.ToString())
+	}
+}
+
+// terminalStatus maps the status of an orchard workflow that is over
+func terminalStatus(orchardStatus string) ScheduleStatus {
+	switch orchardStatus {
+	case "finished":
+		return Finished
+	case "canceled":
+		return Canceled
+	case "timeout":
+		return TimedOut
+	case "deleted":
+		return Deleted
+	}
+	return Failed
+}
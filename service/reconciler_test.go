@@ -0,0 +1,83 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+func TestReconcileWorkflows(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+
+	// orchard ids are named after the status orchard reports for them
+	orchardServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orchardID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/workflow/"), "/details")
+		status := strings.TrimPrefix(orchardID, "wf-")
+		if status == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"%s","name":"reconcile","status":"%s","createdAt":""}`, orchardID, status)
+	}))
+	defer orchardServer.Close()
+	scheduler := &Scheduler{OrchardHost: orchardServer.URL}
+
+	wf := table.Workflow{
+		Name:        "reconcile_test",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       model.Every{Quantity: 1, Unit: model.EveryHour},
+		NextRuntime: time.Now(),
+	}
+	assert.NoError(t, mockDB.Create(&wf).Error)
+
+	activatedAt := time.Now().Add(-10 * time.Minute)
+	runs := map[string]*table.ScheduledWorkflow{}
+	for _, orchardStatus := range []string{"running", "finished", "failed", "missing"} {
+		swf := table.ScheduledWorkflow{
+			WorkflowID:         wf.ID,
+			OrchardID:          "wf-" + orchardStatus,
+			StartTime:          activatedAt,
+			ScheduledStartTime: activatedAt,
+			Status:             Activated.ToString(),
+			ActivatedAt:        &activatedAt,
+		}
+		assert.NoError(t, mockDB.Create(&swf).Error)
+		runs[orchardStatus] = &swf
+	}
+
+	scheduler.reconcileWorkflows(mockDB)
+
+	for orchardStatus, expected := range map[string]string{
+		"running":  Activated.ToString(),
+		"finished": Finished.ToString(),
+		"failed":   Failed.ToString(),
+		"missing":  Deleted.ToString(),
+	} {
+		var swf table.ScheduledWorkflow
+		mockDB.First(&swf, runs[orchardStatus].ID)
+		assert.Equal(t, expected, swf.Status, orchardStatus)
+		if expected == Activated.ToString() {
+			assert.Nil(t, swf.CompletedAt)
+		} else {
+			assert.NotNil(t, swf.CompletedAt)
+			assert.GreaterOrEqual(t, swf.DurationSeconds, int64(600))
+		}
+	}
+
+	cleanupDB(mockDB, dbName)
+}
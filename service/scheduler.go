@@ -8,10 +8,13 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -38,8 +41,27 @@ const (
 	DeleteFailed
 	Activated
 	Created
+	Skipped
+	UpstreamFailed
+	Finished
+	Failed
+	TimedOut
+	Queued
 )
 
+// how a run came to be created
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+	TriggerBackfill  = "backfill"
+)
+
+var ErrWorkflowLocked = errors.New("workflow is locked by a scheduler")
+
+var ScheduleStatuses = []ScheduleStatus{
+	Canceled, CancelFailed, Deleted, DeleteFailed, Activated, Created, Skipped, UpstreamFailed, Finished, Failed, TimedOut, Queued,
+}
+
 func (s ScheduleStatus) ToString() string {
 	switch s {
 	case Canceled:
@@ -54,51 +76,135 @@ func (s ScheduleStatus) ToString() string {
 		return "activated"
 	case Created:
 		return "created"
+	case Skipped:
+		return "skipped"
+	case UpstreamFailed:
+		return "upstream_failed"
+	case Finished:
+		return "finished"
+	case Failed:
+		return "failed"
+	case TimedOut:
+		return "timeout"
+	case Queued:
+		return "queued"
 	}
 	panic("unknown ScheduleStatus")
 }
 
 type Scheduler struct {
-	Interval          time.Duration
-	MaxSize           uint
+	Interval time.Duration
+	// workers of each pool unless set below
+	MaxSize uint
+	// workers creating runs, each running a generator process
+	GenerationWorkers uint
+	// workers activating runs in orchard
+	ActivationWorkers uint
+	// address of the status and metrics endpoints, empty disables them
+	Address           string
 	OrchardHost       string
 	OrchardAPIKeyName string
 	OrchardAPIKey     string
+	// slots picked up later than this are handled by the misfire policy
+	MisfireThreshold time.Duration
+	// how long a run waits for its upstream runs unless the workflow sets it
+	DependencyTimeout time.Duration
+	// how often activated runs are checked in orchard, 0 disables it
+	ReconcileInterval time.Duration
+	// ClaimModeLock (the default) or ClaimModeLease
+	ClaimMode string
+	// how long a lease is held without being renewed in the lease claim mode
+	LeaseDuration time.Duration
+	// locks not refreshed for longer are taken over in the lock claim mode, 0 never takes them over
+	LockTTL time.Duration
+	// how long the leader holds the leadership without renewing it
+	LeaderLease time.Duration
+	// how often the leader runs the cleanup sweep, 0 disables it
+	CleanupInterval time.Duration
+	Cleanup         *Cleanup
+	// how long a shutdown waits for the runs being created and activated
+	ShutdownTimeout time.Duration
+
+	poolsOnce    sync.Once
+	generation   *workerPool
+	activation   *workerPool
+	claims       sync.Map // token of the locks and leases held to their heldClaim
+	instanceOnce sync.Once
+	instance     string
+	leading      atomic.Bool
+	leaderMu     sync.Mutex
+	leader       table.SchedulerLeader // last seen by elect
+
+	upstreamPolls sync.Map // id of the activated upstream runs to when they were last polled
+}
+
+// pools starts the worker pools on first use
+func (s *Scheduler) pools() (*workerPool, *workerPool) {
+	s.poolsOnce.Do(func() {
+		size := func(workers uint) int {
+			if workers == 0 {
+				workers = s.MaxSize
+			}
+			if workers == 0 {
+				workers = 1
+			}
+			return int(workers)
+		}
+		s.generation = newWorkerPool(poolGeneration, size(s.GenerationWorkers))
+		s.activation = newWorkerPool(poolActivation, size(s.ActivationWorkers))
+		fmt.Printf("worker pools started (generation: %d, activation: %d)\n", s.generation.size, s.activation.size)
+	})
+	return s.generation, s.activation
 }
 
-func (s *Scheduler) Start() {
+// Start runs the scheduler until ctx is done, then shuts it down gracefully
+func (s *Scheduler) Start(ctx context.Context) {
 	fmt.Println("Scheduler Started")
-	tick := time.Tick(s.Interval)
-	for range tick {
+	s.pools()
+	go s.serveStatus(ctx)
+	go s.startLeaderElection(ctx)
+	go s.startReconciler(ctx)
+	go s.startCleanup(ctx)
+	every(ctx, s.Interval, func() {
 		s.scheduleWorkflows(database.GetInstance())
 		s.activateWorkflows(database.GetInstance())
-	}
+		s.runBackfills(database.GetInstance())
+		if s.isLeader() {
+			s.resumeWorkflows(database.GetInstance())
+		}
+	})
+	s.shutdown(database.GetInstance())
 }
 
 func (s *Scheduler) scheduleWorkflows(db *gorm.DB) {
 	var workflows []table.Workflow
 
-	db.Model(&table.Workflow{}).
+	query := db.Model(&table.Workflow{}).
 		Joins("left join workflow_scheduler_locks l on workflows.id = l.workflow_id").
-		Where("next_runtime <= ? and is_active = 't' and l.token is null", time.Now()).
+		Where("next_runtime <= ? and is_active = 't'", time.Now())
+	s.unclaimed(query, "workflows").
+		Preload("Calendars").
 		Find(&workflows)
 
+	generation, _ := s.pools()
 	for _, wf := range workflows {
-		go s.lockAndCreate(db, wf)
+		generation.submit(fmt.Sprintf("workflow:%d", wf.ID), func(ctx context.Context) { s.lockAndCreate(ctx, db, wf) })
 	}
 }
 
 func (s *Scheduler) activateWorkflows(db *gorm.DB) {
 	var scheduledWorkflows []table.ScheduledWorkflow
 
-	db.Model(&table.ScheduledWorkflow{}).
+	query := db.Model(&table.ScheduledWorkflow{}).
 		Joins("left join workflow_activator_locks l on scheduled_workflows.id = l.scheduled_id").
-		Where("start_time <= ? and status = 'created' and l.token is null", time.Now()).
+		Where("start_time <= ? and status = 'created'", time.Now())
+	s.unclaimed(query, "scheduled_workflows").
 		Order("start_time").
 		Find(&scheduledWorkflows)
 
+	_, activation := s.pools()
 	for _, swf := range scheduledWorkflows {
-		go s.lockAndActivate(db, swf)
+		activation.submit(fmt.Sprintf("run:%d", swf.ID), func(ctx context.Context) { s.lockAndActivate(ctx, db, swf) })
 	}
 }
 
@@ -139,21 +245,37 @@ func (s *Scheduler) cancelWorkflows(
 	return updatedStatuses
 }
 
+// newRunContext identifies the run of wf generated for the slot
+func newRunContext(wf table.Workflow, slot time.Time, triggerType string) orchard.RunContext {
+	return orchard.RunContext{
+		WorkflowName:       wf.Name,
+		ScheduledStartTime: slot.In(workflowLocation(wf)),
+		RunID:              uuid.New().String(),
+		TriggerType:        triggerType,
+		Parameters:         wf.Parameters,
+		TemplateCommand:    wf.TemplateCommand,
+	}
+}
+
+// createWorkflow generates the orchard workflows of a run, the generator is
+// killed once ctx is done
 func (s *Scheduler) createWorkflow(
+	ctx context.Context,
 	client *orchard.OrchardRestClient,
 	wf table.Workflow,
-) map[string]string {
+	rc orchard.RunContext,
+) (map[string]string, error) {
 	statuses := make(map[string]string)
-	createdIDs, err := client.Create(wf)
+	createdIDs, err := client.Create(ctx, wf, rc)
 	if err != nil {
 		fmt.Printf("[error] error creating workflow (name: %s): %s\n", wf.Name, err)
 		notifyOwner(wf, err)
-		return s.deleteWorkflows(client, createdIDs, statuses)
+		return s.deleteWorkflows(client, createdIDs, statuses), err
 	}
 	for _, createdID := range createdIDs {
 		statuses[createdID] = Created.ToString()
 	}
-	return statuses
+	return statuses, nil
 }
 
 func (s *Scheduler) activateWorkflow(
@@ -169,7 +291,8 @@ func (s *Scheduler) activateWorkflow(
 	return Activated.ToString()
 }
 
-func (s *Scheduler) lockAndCreate(db *gorm.DB, wf table.Workflow) {
+// lockWorkflow takes the scheduler lock of wf, returning its token
+func lockWorkflow(db *gorm.DB, wf table.Workflow) (string, bool) {
 	token := uuid.New().String()
 
 	lock := table.WorkflowSchedulerLock{
@@ -180,7 +303,7 @@ func (s *Scheduler) lockAndCreate(db *gorm.DB, wf table.Workflow) {
 	result := db.Create(&lock)
 	if result.Error != nil {
 		fmt.Printf("something else is creating this workflow (name: %s, workflow_id: %v)! skip...\n", wf.Name, wf.ID)
-		return
+		return "", false
 	}
 
 	existingLock := table.WorkflowSchedulerLock{}
@@ -188,74 +311,332 @@ func (s *Scheduler) lockAndCreate(db *gorm.DB, wf table.Workflow) {
 
 	if existingLock.Token != token {
 		fmt.Printf("something else is creating this workflow (name: %s, workflow_id: %v)! skip...\n", wf.Name, wf.ID)
-		return
+		return "", false
 	}
+	return token, true
+}
 
-	// release the lock
-	defer db.Where("workflow_id = ? and token = ?", wf.ID, token).
+func unlockWorkflow(db *gorm.DB, wf table.Workflow, token string) {
+	db.Where("workflow_id = ? and token = ?", wf.ID, token).
 		Delete(&table.WorkflowSchedulerLock{})
+}
+
+func (s *Scheduler) lockAndCreate(ctx context.Context, db *gorm.DB, wf table.Workflow) {
+	// a workflow picked up before another scheduler moved it on is not due anymore
+	token, ok := s.lockWorkflow(db, wf, "next_runtime = ?", wf.NextRuntime)
+	if !ok {
+		return
+	}
+	// release the lock
+	defer s.unlockWorkflow(db, wf, token)
+
+	if cal, until := blackoutCalendar(wf.Calendars, model.BlackoutDefer, time.Now()); cal != nil {
+		fmt.Printf("workflow (name: %s) deferred until %s by calendar %s\n", wf.Name, until, cal.Name)
+		return
+	}
+
+	if ended, reason := scheduleEnded(wf, wf.NextRuntime, wf.RunCount); ended {
+		s.deactivateWorkflow(db, wf, reason)
+		return
+	}
+
+	plan := planMisfire(wf, time.Now(), s.misfireThreshold())
+	var runs []table.ScheduledWorkflow
+	for _, slot := range plan.skipped {
+		reason := slot.Reason
+		if slot.Count > 1 {
+			reason = fmt.Sprintf("%s, %d slots until %s", slot.Reason, slot.Count, slot.Until.Format(time.RFC3339))
+		}
+		fmt.Printf("skipping workflow (name: %s, scheduled_start_time: %s): %s\n", wf.Name, slot.ScheduledStartTime, reason)
+		until := slot.Until
+		runs = append(runs, table.ScheduledWorkflow{
+			ScheduledStartTime: slot.ScheduledStartTime,
+			SkippedUntil:       &until,
+			Status:             Skipped.ToString(),
+			Reason:             reason,
+		})
+	}
 
-	fmt.Println("creating workflow", wf.Name, token)
 	client := &orchard.OrchardRestClient{
 		Host:       s.OrchardHost,
 		APIKeyName: s.OrchardAPIKeyName,
 		APIKey:     s.OrchardAPIKey,
 	}
+	var inFlight []table.ScheduledWorkflow
+	if wf.OverlapPolicy != "" && wf.OverlapPolicy != model.OverlapAllow {
+		inFlight = s.runsInFlight(db, client, wf)
+	}
+	if n := len(plan.run); wf.OverlapPolicy == model.OverlapReplace && n > 1 {
+		// only the latest slot runs, the earlier ones would be canceled right away
+		for _, slot := range plan.run[:n-1] {
+			runs = append(runs, table.ScheduledWorkflow{
+				ScheduledStartTime: slot,
+				Status:             Skipped.ToString(),
+				Reason:             "replaced by a later run",
+			})
+		}
+		plan.run = plan.run[n-1:]
+	}
 
-	scheduleStatus := s.createWorkflow(client, wf)
+	runCount := wf.RunCount
+	ended, endReason := false, ""
+	startTime := time.Now()
+	for _, slot := range plan.run {
+		if ended, endReason = scheduleEnded(wf, slot, runCount); ended {
+			break
+		}
+		if cal, _ := blackoutCalendar(wf.Calendars, model.BlackoutSkip, slot); cal != nil {
+			fmt.Printf("skipping workflow (name: %s, scheduled_start_time: %s) blacked out by calendar %s\n", wf.Name, slot, cal.Name)
+			runs = append(runs, table.ScheduledWorkflow{
+				ScheduledStartTime: slot,
+				Status:             Skipped.ToString(),
+				Reason:             fmt.Sprintf("blacked out by calendar %s", cal.Name),
+			})
+			continue
+		}
+		if len(inFlight) > 0 && wf.OverlapPolicy == model.OverlapQueue {
+			fmt.Printf("workflow (name: %s, scheduled_start_time: %s) queued behind orchard_id: %s\n", wf.Name, slot, inFlight[0].OrchardID)
+			plan.next = slot
+			break
+		}
+		if len(inFlight) > 0 && wf.OverlapPolicy == model.OverlapForbid {
+			fmt.Printf("skipping workflow (name: %s, scheduled_start_time: %s) overlapping orchard_id: %s\n", wf.Name, slot, inFlight[0].OrchardID)
+			runs = append(runs, table.ScheduledWorkflow{
+				ScheduledStartTime: slot,
+				Status:             Skipped.ToString(),
+				Reason:             fmt.Sprintf("previous run still in progress (orchard_id: %s)", inFlight[0].OrchardID),
+			})
+			continue
+		}
+		if len(inFlight) > 0 && wf.OverlapPolicy == model.OverlapReplace {
+			s.replaceRuns(db, client, wf, inFlight)
+		}
 
-	// add to scheduled and update the next run time
-	db.Transaction(func(tx *gorm.DB) error {
-		startTime := time.Now()
-		for orchardID, status := range scheduleStatus {
-			if err := tx.Create(&table.ScheduledWorkflow{
-				WorkflowID:         wf.ID,
+		rc := newRunContext(wf, slot, TriggerScheduled)
+		fmt.Println("creating workflow", wf.Name, slot, rc.RunID, token)
+		var created []table.ScheduledWorkflow
+		statuses, _ := s.createWorkflow(ctx, client, wf, rc)
+		for orchardID, status := range statuses {
+			run := table.ScheduledWorkflow{
 				OrchardID:          orchardID,
 				StartTime:          startTime,
-				ScheduledStartTime: wf.NextRuntime,
+				ScheduledStartTime: slot,
 				Status:             status,
-			}).Error; err != nil {
-				return err
+				RunID:              rc.RunID,
 			}
+			runs = append(runs, run)
 			startTime = startTime.Add(time.Duration(wf.ScheduleDelayMinutes) * time.Minute)
+			if status == Created.ToString() {
+				created = append(created, run)
+			}
+		}
+		if len(created) > 0 {
+			runCount++
+			inFlight = created
 		}
+	}
+	if !ended {
+		ended, endReason = scheduleEnded(wf, plan.next, runCount)
+	}
 
-		fmt.Println(wf.Every)
+	// add to scheduled and update the next run time, unless another scheduler
+	// took the workflow over meanwhile and may create the same runs
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !s.holdsWorkflow(tx, wf, token) {
+			return errClaimLost
+		}
+		updates := map[string]interface{}{"next_runtime": plan.next, "run_count": runCount}
+		if ended {
+			// that was the last run
+			updates["is_active"] = false
+		}
+		result := tx.Model(&wf).Where("next_runtime = ?", wf.NextRuntime).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errClaimLost
+		}
 
-		if err := tx.Model(&wf).Update(
-			"next_runtime", nextRuntime(wf.NextRuntime, wf.Every, wf.Backfill),
-		).Error; err != nil {
-			return err
+		for _, run := range runs {
+			run.WorkflowID = wf.ID
+			if run.StartTime.IsZero() {
+				run.StartTime = time.Now()
+			}
+			run.TriggerType = TriggerScheduled
+			run.WorkflowVersion = wf.Version
+			if err := tx.Create(&run).Error; err != nil {
+				return err
+			}
 		}
 		return nil
 	})
+	if errors.Is(err, errClaimLost) {
+		// the runs created in orchard are not recorded, nothing would activate them
+		fmt.Printf("[warning] workflow (name: %s) claim lost (token: %s), deleting the runs created\n", wf.Name, token)
+		for _, run := range runs {
+			if run.Status == Created.ToString() {
+				s.deleteWorkflows(client, []string{run.OrchardID}, map[string]string{})
+			}
+		}
+		return
+	}
+	if err != nil {
+		fmt.Printf("[error] error recording the runs of workflow (name: %s): %s\n", wf.Name, err)
+	}
+	if err == nil && ended {
+		notifyOwnerCompleted(wf, endReason)
+	}
 }
 
-func (s *Scheduler) lockAndActivate(db *gorm.DB, swf table.ScheduledWorkflow) {
-	token := uuid.New().String()
+// triggerWorkflow creates a run of wf for the given logical time outside of
+// its schedule, next_runtime and the run count are left alone
+func (s *Scheduler) triggerWorkflow(ctx context.Context, db *gorm.DB, wf table.Workflow, logicalTime time.Time) ([]table.ScheduledWorkflow, error) {
+	token, ok := s.lockWorkflow(db, wf)
+	if !ok {
+		return nil, ErrWorkflowLocked
+	}
+	defer s.unlockWorkflow(db, wf, token)
 
-	lock := table.WorkflowActivatorLock{
-		ScheduledID: swf.ID,
-		Token:       token,
-		LockTime:    time.Now(),
+	rc := newRunContext(wf, logicalTime, TriggerManual)
+	fmt.Println("triggering workflow", wf.Name, logicalTime, rc.RunID, token)
+	client := &orchard.OrchardRestClient{
+		Host:       s.OrchardHost,
+		APIKeyName: s.OrchardAPIKeyName,
+		APIKey:     s.OrchardAPIKey,
 	}
-	result := db.Create(&lock)
-	if result.Error != nil {
-		fmt.Printf("something else is activating this scheduled workflow (scheduled_workflow_id: %v)! skip...\n", swf.ID)
+	statuses, createErr := s.createWorkflow(ctx, client, wf, rc)
+
+	runs := []table.ScheduledWorkflow{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		startTime := time.Now()
+		for orchardID, status := range statuses {
+			run := table.ScheduledWorkflow{
+				WorkflowID:         wf.ID,
+				OrchardID:          orchardID,
+				StartTime:          startTime,
+				ScheduledStartTime: logicalTime,
+				Status:             status,
+				TriggerType:        TriggerManual,
+				RunID:              rc.RunID,
+				WorkflowVersion:    wf.Version,
+			}
+			if err := tx.Create(&run).Error; err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			startTime = startTime.Add(time.Duration(wf.ScheduleDelayMinutes) * time.Minute)
+		}
+		return nil
+	})
+	if createErr != nil {
+		return runs, createErr
+	}
+	return runs, err
+}
+
+// runsInFlight returns the runs of wf that are not over yet, whatever their
+// slot, e.g. a manual trigger doesn't hide an older run. The activated ones
+// are checked with orchard.
+func (s *Scheduler) runsInFlight(db *gorm.DB, client *orchard.OrchardRestClient, wf table.Workflow) []table.ScheduledWorkflow {
+	var runs []table.ScheduledWorkflow
+	db.Where("workflow_id = ? and status in ?", wf.ID, []string{Created.ToString(), Activated.ToString()}).
+		Order("scheduled_start_time").
+		Find(&runs)
+
+	inFlight := []table.ScheduledWorkflow{}
+	for _, swf := range runs {
+		switch swf.Status {
+		case Created.ToString():
+			inFlight = append(inFlight, swf)
+		case Activated.ToString():
+			details, err := client.Details(swf.OrchardID)
+			if err != nil {
+				// can't tell, assume it is still running
+				fmt.Printf("[warning] error getting workflow details (orchard_id: %s): %s\n", swf.OrchardID, err)
+				inFlight = append(inFlight, swf)
+			} else if !details.IsTerminal() {
+				inFlight = append(inFlight, swf)
+			}
+		}
+	}
+	return inFlight
+}
+
+// replaceRuns cancels the activated runs and deletes the ones not activated
+// yet, recording their updated status. A created run is only deleted under
+// its activator lock, the ones being activated are left alone.
+func (s *Scheduler) replaceRuns(
+	db *gorm.DB,
+	client *orchard.OrchardRestClient,
+	wf table.Workflow,
+	runs []table.ScheduledWorkflow,
+) {
+	for _, swf := range runs {
+		if swf.Status == Created.ToString() {
+			s.replaceCreatedRun(db, client, wf, swf)
+			continue
+		}
+		fmt.Printf("replacing workflow (name: %s, orchard_id: %s)\n", wf.Name, swf.OrchardID)
+		status := s.cancelWorkflows(client, map[string]string{swf.OrchardID: swf.Status})[swf.OrchardID]
+		if err := db.Model(&swf).Update("status", status).Error; err != nil {
+			fmt.Printf("[error] error recording replaced workflow (orchard_id: %s): %s\n", swf.OrchardID, err)
+		}
+	}
+}
+
+func (s *Scheduler) replaceCreatedRun(
+	db *gorm.DB,
+	client *orchard.OrchardRestClient,
+	wf table.Workflow,
+	swf table.ScheduledWorkflow,
+) {
+	token, ok := s.lockRun(db, swf)
+	if !ok {
 		return
 	}
+	defer s.unlockRun(db, swf, token)
 
-	existingLock := table.WorkflowActivatorLock{}
-	db.First(&existingLock, swf.ID)
+	// activated before the lock was taken
+	if db.Where("id = ? and status = ?", swf.ID, Created.ToString()).Limit(1).Find(&table.ScheduledWorkflow{}).RowsAffected == 0 {
+		fmt.Printf("workflow (name: %s, orchard_id: %s) was activated meanwhile, not replaced\n", wf.Name, swf.OrchardID)
+		return
+	}
+	fmt.Printf("replacing workflow (name: %s, orchard_id: %s)\n", wf.Name, swf.OrchardID)
+	status := s.deleteWorkflows(client, []string{swf.OrchardID}, map[string]string{})[swf.OrchardID]
+	if err := db.Model(&swf).Update("status", status).Error; err != nil {
+		fmt.Printf("[error] error recording replaced workflow (orchard_id: %s): %s\n", swf.OrchardID, err)
+	}
+}
 
-	if existingLock.Token != token {
-		fmt.Printf("something else is activating this scheduled workflow (scheduled_workflow_id: %v)! skip...\n", swf.ID)
+// scheduleEnded reports whether the slot at next is past the end of the
+// workflow schedule, given the number of runs already created
+func scheduleEnded(wf table.Workflow, next time.Time, runCount uint) (bool, string) {
+	if wf.EndTime != nil && next.After(*wf.EndTime) {
+		return true, fmt.Sprintf("end time %s reached", wf.EndTime.Format(time.RFC3339))
+	}
+	if wf.MaxRuns > 0 && runCount >= wf.MaxRuns {
+		return true, fmt.Sprintf("maximum of %d runs reached", wf.MaxRuns)
+	}
+	return false, ""
+}
+
+func (s *Scheduler) deactivateWorkflow(db *gorm.DB, wf table.Workflow, reason string) {
+	fmt.Printf("deactivating workflow (name: %s, workflow_id: %v): %s\n", wf.Name, wf.ID, reason)
+	if err := db.Model(&wf).Update("is_active", false).Error; err != nil {
+		fmt.Printf("[error] error deactivating workflow (name: %s): %s\n", wf.Name, err)
 		return
 	}
+	notifyOwnerCompleted(wf, reason)
+}
 
+func (s *Scheduler) lockAndActivate(ctx context.Context, db *gorm.DB, swf table.ScheduledWorkflow) {
+	token, ok := s.lockRun(db, swf)
+	if !ok {
+		return
+	}
 	// release the lock
-	defer db.Where("scheduled_id = ? and token = ?", swf.ID, token).
-		Delete(&table.WorkflowActivatorLock{})
+	defer s.unlockRun(db, swf, token)
 
 	client := &orchard.OrchardRestClient{
 		Host:       s.OrchardHost,
@@ -264,20 +645,67 @@ func (s *Scheduler) lockAndActivate(db *gorm.DB, swf table.ScheduledWorkflow) {
 	}
 
 	wf := table.Workflow{}
-	db.First(&wf, swf.WorkflowID)
+	db.Preload("Upstreams").First(&wf, swf.WorkflowID)
+
+	if len(wf.Upstreams) > 0 {
+		outcome, reason := s.checkUpstreams(db, client, wf, swf)
+		if outcome == upstreamsPending {
+			timeout := s.dependencyTimeout(wf)
+			if time.Since(swf.StartTime) <= timeout {
+				fmt.Printf("workflow (name: %s, orchard_id: %s) waiting for upstream runs\n", wf.Name, swf.OrchardID)
+				return
+			}
+			outcome, reason = upstreamsFailed, fmt.Sprintf("upstream runs did not succeed within %s", timeout)
+		}
+		switch outcome {
+		case upstreamsFailed:
+			s.failUpstream(db, client, wf, swf, UpstreamFailed, reason)
+			return
+		case upstreamsSkipped:
+			s.failUpstream(db, client, wf, swf, Skipped, reason)
+			return
+		}
+	}
 
+	if ctx.Err() != nil {
+		// stopped at the shutdown deadline, the run is left for another scheduler
+		return
+	}
 	fmt.Printf("activating workflow (name: %s, orchard_id: %s, token: %s)\n", wf.Name, swf.OrchardID, token)
 	status := s.activateWorkflow(client, swf, wf)
 
 	// update status in scheduled_workflows table
 	db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&swf).Update("status", status).Error; err != nil {
+		updates := map[string]interface{}{"status": status}
+		if status == Activated.ToString() {
+			updates["activated_at"] = time.Now()
+		}
+		if err := tx.Model(&swf).Updates(updates).Error; err != nil {
 			return err
 		}
 		return nil
 	})
 }
 
+// blackoutCalendar returns the first calendar with the given action that has
+// t inside one of its windows, along with the time the window is over
+func blackoutCalendar(calendars []table.Calendar, action model.BlackoutAction, t time.Time) (*table.Calendar, time.Time) {
+	for i, cal := range calendars {
+		if cal.Action != action {
+			continue
+		}
+		loc, err := model.LoadTimezone(cal.Timezone)
+		if err != nil {
+			fmt.Printf("[warning] %s, falling back to UTC (calendar: %s)\n", err, cal.Name)
+			loc = time.UTC
+		}
+		if until, ok := model.BlackoutUntil(t, loc, cal.DateRanges, cal.WeeklyWindows); ok {
+			return &calendars[i], until
+		}
+	}
+	return nil, time.Time{}
+}
+
 func notifyOwner(wf table.Workflow, orchardErr error) {
 	errMsg := fmt.Sprintf(
 		"[error] Failed to schedule workflow (name: %s, workflow_id: %v) with error %q\n",
@@ -286,6 +714,42 @@ func notifyOwner(wf table.Workflow, orchardErr error) {
 		orchardErr,
 	)
 	log.Println(errMsg)
+	publishToOwner(wf, viper.GetString(common.SNSConfigSubject), errMsg)
+}
+
+// notifyOwnerCompleted tells the owner a workflow was deactivated because its
+// schedule reached its end time or maximum run count
+func notifyOwnerCompleted(wf table.Workflow, reason string) {
+	msg := fmt.Sprintf(
+		"Workflow (name: %s, workflow_id: %v) has been deactivated: %s\n",
+		wf.Name,
+		wf.ID,
+		reason,
+	)
+	log.Println(msg)
+	subjectTemplate := viper.GetString(common.SNSConfigCompletedSubject)
+	if subjectTemplate == "" {
+		subjectTemplate = "Workflow Schedule Completed"
+	}
+	publishToOwner(wf, subjectTemplate, msg)
+}
+
+// notifyOwnerRunFailed tells the owner an activated run did not finish
+// successfully in orchard
+func notifyOwnerRunFailed(wf table.Workflow, swf table.ScheduledWorkflow, status string) {
+	errMsg := fmt.Sprintf(
+		"[error] Workflow run (name: %s, workflow_id: %v, orchard_id: %s, scheduled_start_time: %s) ended with status %q\n",
+		wf.Name,
+		wf.ID,
+		swf.OrchardID,
+		swf.ScheduledStartTime.Format(time.RFC3339),
+		status,
+	)
+	log.Println(errMsg)
+	publishToOwner(wf, viper.GetString(common.SNSConfigSubject), errMsg)
+}
+
+func publishToOwner(wf table.Workflow, subjectTemplate string, msg string) {
 	if wf.Owner == nil || *wf.Owner == "" {
 		return
 	}
@@ -296,7 +760,6 @@ func notifyOwner(wf table.Workflow, orchardErr error) {
 		log.Println("[error] error initiating SNS client")
 	}
 
-	subjectTemplate := viper.GetString(common.SNSConfigSubject)
 	var subject string
 
 	// Create template with custom functions
@@ -339,7 +802,7 @@ func notifyOwner(wf table.Workflow, orchardErr error) {
 	}
 
 	// If subject exceeds 100 characters, truncate at the last whitespace before position 100
-	messageBody := errMsg
+	messageBody := msg
 	if len(subject) > 100 {
 		// Find the last whitespace before position 100
 		truncatePos := strings.LastIndexAny(subject[:100], " \t\n")
@@ -352,7 +815,7 @@ func notifyOwner(wf table.Workflow, orchardErr error) {
 
 		// Only add truncation message if there's actual content that was truncated
 		if exceededPortion != "" {
-			messageBody = fmt.Sprintf("Subject (truncated): %s\n\n%s", exceededPortion, errMsg)
+			messageBody = fmt.Sprintf("Subject (truncated): %s\n\n%s", exceededPortion, msg)
 		}
 	}
 
@@ -381,30 +844,45 @@ func notifyOwner(wf table.Workflow, orchardErr error) {
 	)
 }
 
-// ignore addInterval parsing error here, since it shouldn't fail
-func nextRuntime(start time.Time, every model.Every, backfill bool) time.Time {
-	next := addInterval(start, every)
-	if backfill || next.After(time.Now()) {
-		return next
-	} else {
-		return nextRuntime(next, every, backfill)
+// addInterval steps someTime by every in someTime's location. Minutes and
+// hours are fixed durations, days and longer follow the wall clock and keep
+// the time of day of anchor (if any) so a slot shifted by a DST gap doesn't
+// drag the following ones along.
+func addInterval(someTime time.Time, every model.Every, anchor *time.Time) time.Time {
+	if every.IsCron() {
+		return every.Cron.Next(someTime)
+	}
+
+	wall := someTime
+	if anchor != nil {
+		wall = anchor.In(someTime.Location())
+	}
+	addDate := func(years int, months int, days int) time.Time {
+		return model.WallClock(
+			someTime.Year()+years,
+			someTime.Month()+time.Month(months),
+			someTime.Day()+days,
+			wall.Hour(),
+			wall.Minute(),
+			wall.Second(),
+			wall.Nanosecond(),
+			someTime.Location(),
+		)
 	}
-}
 
-func addInterval(someTime time.Time, every model.Every) time.Time {
 	switch every.Unit {
 	case model.EveryMinute:
 		return someTime.Add(time.Duration(every.Quantity) * time.Minute)
 	case model.EveryHour:
 		return someTime.Add(time.Duration(every.Quantity) * time.Hour)
 	case model.EveryDay:
-		return someTime.AddDate(0, 0, int(every.Quantity))
+		return addDate(0, 0, int(every.Quantity))
 	case model.EveryWeek:
-		return someTime.AddDate(0, 0, int(every.Quantity*7))
+		return addDate(0, 0, int(every.Quantity*7))
 	case model.EveryMonth:
-		return someTime.AddDate(0, int(every.Quantity), 0)
+		return addDate(0, int(every.Quantity), 0)
 	case model.EveryYear:
-		return someTime.AddDate(int(every.Quantity), 0, 0)
+		return addDate(int(every.Quantity), 0, 0)
 	}
 	panic(fmt.Sprintf("Every unit '%s' not recognized", every.Unit))
 }
@@ -0,0 +1,400 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+	"mce.salesforce.com/sprinkler/model"
+)
+
+func TestAddInterval(t *testing.T) {
+	loc, err := model.LoadTimezone("America/New_York")
+	assert.NoError(t, err)
+	daily := model.Every{Quantity: 1, Unit: model.EveryDay}
+
+	t.Run("Daily keeps local midnight across DST", func(t *testing.T) {
+		start := time.Date(2024, 3, 9, 0, 0, 0, 0, loc)
+		next := addInterval(start, daily, nil)
+		assert.Equal(t, time.Date(2024, 3, 10, 0, 0, 0, 0, loc), next)
+		next = addInterval(next, daily, nil)
+		assert.Equal(t, 23*time.Hour, next.Sub(time.Date(2024, 3, 10, 0, 0, 0, 0, loc)))
+	})
+
+	t.Run("Nonexistent time is shifted forward once", func(t *testing.T) {
+		anchor := time.Date(2024, 3, 1, 2, 30, 0, 0, loc)
+		next := addInterval(time.Date(2024, 3, 9, 2, 30, 0, 0, loc), daily, &anchor)
+		assert.True(t, next.Equal(time.Date(2024, 3, 10, 3, 30, 0, 0, loc)))
+		next = addInterval(next, daily, &anchor)
+		assert.True(t, next.Equal(time.Date(2024, 3, 11, 2, 30, 0, 0, loc)))
+	})
+
+	t.Run("Hours are fixed durations", func(t *testing.T) {
+		start := time.Date(2024, 11, 3, 0, 30, 0, 0, loc)
+		next := addInterval(start, model.Every{Quantity: 2, Unit: model.EveryHour}, nil)
+		assert.Equal(t, 2*time.Hour, next.Sub(start))
+		assert.Equal(t, 1, next.Hour())
+	})
+
+	t.Run("Cron", func(t *testing.T) {
+		every, err := model.ParseEvery("0 0 1,15 * *")
+		assert.NoError(t, err)
+		next := addInterval(time.Date(2024, 1, 1, 0, 0, 0, 0, loc), every, nil)
+		assert.True(t, next.Equal(time.Date(2024, 1, 15, 0, 0, 0, 0, loc)))
+	})
+}
+
+func TestLockAndCreateBlackout(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	scheduler := &Scheduler{}
+
+	slot := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	cal := table.Calendar{
+		Name:   "blackout_test",
+		Action: model.BlackoutSkip,
+		DateRanges: model.DateRanges{
+			{Start: slot.Add(-time.Hour), End: slot.Add(time.Hour)},
+		},
+	}
+	assert.NoError(t, mockDB.Create(&cal).Error)
+
+	wf := table.Workflow{
+		Name:        "blackout_test",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       model.Every{Quantity: 1, Unit: model.EveryDay},
+		NextRuntime: slot,
+		IsActive:    true,
+		Calendars:   []table.Calendar{cal},
+	}
+	assert.NoError(t, mockDB.Create(&wf).Error)
+
+	scheduler.lockAndCreate(context.Background(), mockDB, wf)
+
+	var runs []table.ScheduledWorkflow
+	mockDB.Where("workflow_id = ?", wf.ID).Find(&runs)
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, Skipped.ToString(), runs[0].Status)
+	assert.True(t, runs[0].ScheduledStartTime.Equal(slot))
+	assert.Contains(t, runs[0].Reason, "blackout_test")
+
+	var updated table.Workflow
+	mockDB.First(&updated, wf.ID)
+	assert.True(t, updated.NextRuntime.Equal(slot.AddDate(0, 0, 1)))
+
+	cleanupDB(mockDB, dbName)
+}
+
+func TestScheduleEnded(t *testing.T) {
+	endTime := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	wf := table.Workflow{EndTime: &endTime, MaxRuns: 3}
+
+	ended, _ := scheduleEnded(wf, endTime, 2)
+	assert.False(t, ended)
+
+	ended, reason := scheduleEnded(wf, endTime.Add(time.Second), 2)
+	assert.True(t, ended)
+	assert.Contains(t, reason, "end time")
+
+	ended, reason = scheduleEnded(wf, endTime, 3)
+	assert.True(t, ended)
+	assert.Contains(t, reason, "maximum of 3 runs")
+
+	ended, _ = scheduleEnded(table.Workflow{}, endTime, 100)
+	assert.False(t, ended)
+}
+
+func TestLockAndCreatePastEndTime(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+	scheduler := &Scheduler{}
+
+	endTime := time.Now().UTC().Add(-2 * time.Hour)
+	wf := table.Workflow{
+		Name:        "end_time_test",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       model.Every{Quantity: 1, Unit: model.EveryHour},
+		NextRuntime: endTime.Add(time.Hour),
+		EndTime:     &endTime,
+		IsActive:    true,
+	}
+	assert.NoError(t, mockDB.Create(&wf).Error)
+
+	scheduler.lockAndCreate(context.Background(), mockDB, wf)
+
+	var count int64
+	mockDB.Model(&table.ScheduledWorkflow{}).Where("workflow_id = ?", wf.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	var updated table.Workflow
+	mockDB.First(&updated, wf.ID)
+	assert.False(t, updated.IsActive)
+
+	cleanupDB(mockDB, dbName)
+}
+
+func TestLockAndCreateOverlap(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+
+	var deleted []string
+	orchardServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer orchardServer.Close()
+	scheduler := &Scheduler{MisfireThreshold: 5 * time.Minute, OrchardHost: orchardServer.URL}
+
+	slot := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	setup := func(name string, policy model.OverlapPolicy) (table.Workflow, table.ScheduledWorkflow) {
+		wf := table.Workflow{
+			Name:          name,
+			Artifact:      "test.jar",
+			Command:       "java -jar test.jar",
+			Every:         model.Every{Quantity: 1, Unit: model.EveryHour},
+			NextRuntime:   slot,
+			IsActive:      true,
+			OverlapPolicy: policy,
+		}
+		assert.NoError(t, mockDB.Create(&wf).Error)
+		previous := table.ScheduledWorkflow{
+			WorkflowID:         wf.ID,
+			OrchardID:          fmt.Sprintf("wf-%s", name),
+			StartTime:          slot.Add(-time.Hour),
+			ScheduledStartTime: slot.Add(-time.Hour),
+			Status:             Created.ToString(),
+		}
+		assert.NoError(t, mockDB.Create(&previous).Error)
+		return wf, previous
+	}
+
+	t.Run("Forbid skips the slot", func(t *testing.T) {
+		wf, _ := setup("overlap_forbid", model.OverlapForbid)
+		scheduler.lockAndCreate(context.Background(), mockDB, wf)
+
+		var run table.ScheduledWorkflow
+		mockDB.Where("workflow_id = ? and scheduled_start_time = ?", wf.ID, slot).First(&run)
+		assert.Equal(t, Skipped.ToString(), run.Status)
+		assert.Contains(t, run.Reason, "wf-overlap_forbid")
+
+		var updated table.Workflow
+		mockDB.First(&updated, wf.ID)
+		assert.True(t, updated.NextRuntime.Equal(slot.Add(time.Hour)))
+	})
+
+	t.Run("Queue waits for the previous run", func(t *testing.T) {
+		wf, _ := setup("overlap_queue", model.OverlapQueue)
+		scheduler.lockAndCreate(context.Background(), mockDB, wf)
+
+		var count int64
+		mockDB.Model(&table.ScheduledWorkflow{}).Where("workflow_id = ?", wf.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		var updated table.Workflow
+		mockDB.First(&updated, wf.ID)
+		assert.True(t, updated.NextRuntime.Equal(slot))
+	})
+
+	t.Run("Replace deletes the previous run", func(t *testing.T) {
+		wf, previous := setup("overlap_replace", model.OverlapReplace)
+		scheduler.lockAndCreate(context.Background(), mockDB, wf)
+
+		mockDB.First(&previous, previous.ID)
+		assert.Equal(t, Deleted.ToString(), previous.Status)
+		assert.Contains(t, deleted, "/v1/workflow/wf-overlap_replace")
+	})
+
+	t.Run("Forbid sees a run older than the latest slot", func(t *testing.T) {
+		wf, _ := setup("overlap_forbid_older", model.OverlapForbid)
+		manual := table.ScheduledWorkflow{
+			WorkflowID:         wf.ID,
+			OrchardID:          "wf-overlap_forbid_older-manual",
+			StartTime:          slot.Add(-time.Minute),
+			ScheduledStartTime: slot.Add(-time.Minute),
+			Status:             Finished.ToString(),
+		}
+		assert.NoError(t, mockDB.Create(&manual).Error)
+		scheduler.lockAndCreate(context.Background(), mockDB, wf)
+
+		var run table.ScheduledWorkflow
+		mockDB.Where("workflow_id = ? and scheduled_start_time = ?", wf.ID, slot).First(&run)
+		assert.Equal(t, Skipped.ToString(), run.Status)
+		assert.Contains(t, run.Reason, "wf-overlap_forbid_older")
+	})
+
+	t.Run("Replace leaves a run being activated", func(t *testing.T) {
+		wf, previous := setup("overlap_replace_locked", model.OverlapReplace)
+		token, ok := scheduler.lockRun(mockDB, previous)
+		assert.True(t, ok)
+		scheduler.lockAndCreate(context.Background(), mockDB, wf)
+		scheduler.unlockRun(mockDB, previous, token)
+
+		mockDB.First(&previous, previous.ID)
+		assert.Equal(t, Created.ToString(), previous.Status)
+		assert.NotContains(t, deleted, "/v1/workflow/wf-overlap_replace_locked")
+	})
+
+	cleanupDB(mockDB, dbName)
+}
+
+func TestLockAndActivateUpstream(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+
+	upstreamStatus := "running"
+	var polls int32
+	orchardServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&polls, 1)
+			fmt.Fprintf(w, `{"id":"wf-upstream","name":"upstream","status":"%s","createdAt":""}`, upstreamStatus)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer orchardServer.Close()
+	// the outcome of activated runs is recorded by the reconciler
+	scheduler := &Scheduler{DependencyTimeout: time.Hour, OrchardHost: orchardServer.URL, ReconcileInterval: time.Minute}
+
+	slot := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	upstream := table.Workflow{
+		Name:        "upstream",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       model.Every{Quantity: 1, Unit: model.EveryHour},
+		NextRuntime: slot,
+	}
+	assert.NoError(t, mockDB.Create(&upstream).Error)
+	downstream := table.Workflow{
+		Name:        "downstream",
+		Artifact:    "test.jar",
+		Command:     "java -jar test.jar",
+		Every:       model.Every{Quantity: 1, Unit: model.EveryHour},
+		NextRuntime: slot,
+		Upstreams:   []table.Workflow{upstream},
+	}
+	assert.NoError(t, mockDB.Create(&downstream).Error)
+
+	newRun := func(wf table.Workflow, orchardID string, status string, startTime time.Time) table.ScheduledWorkflow {
+		swf := table.ScheduledWorkflow{
+			WorkflowID:         wf.ID,
+			OrchardID:          orchardID,
+			StartTime:          startTime,
+			ScheduledStartTime: slot,
+			Status:             status,
+		}
+		assert.NoError(t, mockDB.Create(&swf).Error)
+		return swf
+	}
+	statusOf := func(swf table.ScheduledWorkflow) table.ScheduledWorkflow {
+		mockDB.First(&swf, swf.ID)
+		return swf
+	}
+
+	run := newRun(downstream, "wf-downstream", Created.ToString(), slot)
+
+	t.Run("Waits for the upstream run to be scheduled", func(t *testing.T) {
+		scheduler.lockAndActivate(context.Background(), mockDB, run)
+		assert.Equal(t, Created.ToString(), statusOf(run).Status)
+	})
+
+	upstreamRun := newRun(upstream, "wf-upstream", Activated.ToString(), slot)
+	recordUpstream := func(status ScheduleStatus) {
+		mockDB.Model(&upstreamRun).Update("status", status.ToString())
+	}
+
+	t.Run("Waits for the upstream run to finish", func(t *testing.T) {
+		scheduler.lockAndActivate(context.Background(), mockDB, run)
+		assert.Equal(t, Created.ToString(), statusOf(run).Status)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&polls), "orchard is left to the reconciler")
+	})
+
+	t.Run("Activates once the upstream run succeeded", func(t *testing.T) {
+		recordUpstream(Finished)
+		scheduler.lockAndActivate(context.Background(), mockDB, run)
+		assert.Equal(t, Activated.ToString(), statusOf(run).Status)
+	})
+
+	t.Run("Fails when the upstream run failed", func(t *testing.T) {
+		recordUpstream(Failed)
+		failing := newRun(downstream, "wf-downstream-2", Created.ToString(), slot)
+		scheduler.lockAndActivate(context.Background(), mockDB, failing)
+		failing = statusOf(failing)
+		assert.Equal(t, UpstreamFailed.ToString(), failing.Status)
+		assert.Contains(t, failing.Reason, upstreamRun.OrchardID)
+	})
+
+	t.Run("Waits for a queued upstream run", func(t *testing.T) {
+		recordUpstream(Queued)
+		queued := newRun(downstream, "wf-downstream-queued", Created.ToString(), slot)
+		scheduler.lockAndActivate(context.Background(), mockDB, queued)
+		assert.Equal(t, Created.ToString(), statusOf(queued).Status)
+	})
+
+	t.Run("Fails after the timeout", func(t *testing.T) {
+		recordUpstream(Activated)
+		late := newRun(downstream, "wf-downstream-3", Created.ToString(), slot.Add(-2*time.Hour))
+		scheduler.lockAndActivate(context.Background(), mockDB, late)
+		late = statusOf(late)
+		assert.Equal(t, UpstreamFailed.ToString(), late.Status)
+		assert.Contains(t, late.Reason, "did not succeed within")
+	})
+
+	t.Run("Polls orchard at most every poll interval without the reconciler", func(t *testing.T) {
+		polling := &Scheduler{DependencyTimeout: time.Hour, OrchardHost: orchardServer.URL}
+		waiting := newRun(downstream, "wf-downstream-4", Created.ToString(), slot)
+		polling.lockAndActivate(context.Background(), mockDB, waiting)
+		polling.lockAndActivate(context.Background(), mockDB, waiting)
+		assert.Equal(t, Created.ToString(), statusOf(waiting).Status)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&polls))
+
+		upstreamStatus = "finished"
+		polling.upstreamPolls.Delete(upstreamRun.ID)
+		polling.lockAndActivate(context.Background(), mockDB, waiting)
+		assert.Equal(t, Activated.ToString(), statusOf(waiting).Status)
+	})
+
+	t.Run("Skipped with a skipped upstream slot", func(t *testing.T) {
+		skippedSlot := slot.Add(-3 * time.Hour)
+		until := slot.Add(-time.Hour)
+		assert.NoError(t, mockDB.Create(&table.ScheduledWorkflow{
+			WorkflowID:         upstream.ID,
+			StartTime:          skippedSlot,
+			ScheduledStartTime: skippedSlot,
+			SkippedUntil:       &until,
+			Status:             Skipped.ToString(),
+			Reason:             "missed, misfire policy skip",
+		}).Error)
+		skipped := newRun(downstream, "wf-downstream-5", Created.ToString(), slot)
+		mockDB.Model(&skipped).Update("scheduled_start_time", slot.Add(-2*time.Hour))
+		scheduler.lockAndActivate(context.Background(), mockDB, statusOf(skipped))
+		skipped = statusOf(skipped)
+		assert.Equal(t, Skipped.ToString(), skipped.Status)
+		assert.Contains(t, skipped.Reason, "upstream upstream run skipped")
+	})
+
+	t.Run("Activates once a rerun of the failed upstream run finished", func(t *testing.T) {
+		recordUpstream(Failed)
+		newRun(upstream, "wf-upstream-rerun", Finished.ToString(), slot.Add(time.Minute))
+		rerun := newRun(downstream, "wf-downstream-6", Created.ToString(), slot)
+		scheduler.lockAndActivate(context.Background(), mockDB, rerun)
+		assert.Equal(t, Activated.ToString(), statusOf(rerun).Status)
+	})
+
+	cleanupDB(mockDB, dbName)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultShutdownTimeout = 25 * time.Second
+
+// how long the work still running at the shutdown deadline has to stop once
+// canceled, the generators being killed
+const shutdownCancelGrace = 5 * time.Second
+
+// every calls run every interval until ctx is done
+func every(ctx context.Context, interval time.Duration, run func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
+
+// serve runs server until ctx is done, then shuts it down gracefully, the
+// requests in flight having until the timeout to finish
+func serve(ctx context.Context, server *http.Server, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("[warning] requests still in flight at the shutdown deadline: %s\n", err)
+		server.Close()
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Scheduler) shutdownTimeout() time.Duration {
+	if s.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return s.ShutdownTimeout
+}
+
+// shutdown stops claiming new work and waits for the runs being created and
+// activated until the shutdown timeout. The work still running is then
+// canceled, the work that stopped releases its locks and leases, the others
+// are left to expire. The leadership is released.
+func (s *Scheduler) shutdown(db *gorm.DB) {
+	fmt.Printf("Scheduler stopping, waiting up to %s for the work in flight\n", s.shutdownTimeout())
+	deadline := time.Now().Add(s.shutdownTimeout())
+	generation, activation := s.pools()
+	for _, pool := range []*workerPool{generation, activation} {
+		if pool.stop(deadline) {
+			continue
+		}
+		fmt.Printf("[warning] %s pool still busy at the shutdown deadline, canceling its work\n", pool.name)
+		if !pool.wait(time.Now().Add(shutdownCancelGrace)) {
+			fmt.Printf("[warning] %s pool work didn't stop once canceled\n", pool.name)
+		}
+	}
+	s.abandonClaims()
+	s.resign(db)
+	fmt.Println("Scheduler stopped")
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"mce.salesforce.com/sprinkler/database/table"
+)
+
+func TestSchedulerShutdown(t *testing.T) {
+	dbName := fmt.Sprintf("%s_%s", uuid.New().String(), testDBName)
+	mockDB := getMockDB(dbName)
+
+	var wf table.Workflow
+	mockDB.Where("name = ?", getTestName).First(&wf)
+	swf := table.ScheduledWorkflow{WorkflowID: wf.ID, StartTime: time.Now(), ScheduledStartTime: time.Now(), Status: Created.ToString()}
+	assert.NoError(t, mockDB.Create(&swf).Error)
+
+	t.Run("Canceled work releases its leases and the leadership is released", func(t *testing.T) {
+		scheduler := &Scheduler{ClaimMode: ClaimModeLease, ShutdownTimeout: 100 * time.Millisecond}
+		scheduler.elect(mockDB)
+		assert.True(t, scheduler.isLeader())
+		generation, _ := scheduler.pools()
+		locked := make(chan struct{})
+		generation.submit("workflow:1", func(ctx context.Context) {
+			token, ok := scheduler.lockWorkflow(mockDB, wf)
+			assert.True(t, ok)
+			defer scheduler.unlockWorkflow(mockDB, wf, token)
+			close(locked)
+			// a generator running past the deadline
+			<-ctx.Done()
+		})
+		<-locked
+
+		scheduler.shutdown(mockDB)
+		var current table.Workflow
+		mockDB.First(&current, wf.ID)
+		assert.Equal(t, "", current.ClaimToken)
+		assert.Nil(t, current.ClaimExpiresAt)
+		assert.False(t, scheduler.isLeader())
+		var leaders int64
+		mockDB.Model(&table.SchedulerLeader{}).Count(&leaders)
+		assert.Equal(t, int64(0), leaders)
+	})
+
+	t.Run("Locks of work still running are left to expire", func(t *testing.T) {
+		scheduler := &Scheduler{ShutdownTimeout: 100 * time.Millisecond}
+		wfToken, ok := scheduler.lockWorkflow(mockDB, wf)
+		assert.True(t, ok)
+		runToken, ok := scheduler.lockRun(mockDB, swf)
+		assert.True(t, ok)
+
+		scheduler.shutdown(mockDB)
+		var locks int64
+		mockDB.Model(&table.WorkflowSchedulerLock{}).Where("token = ?", wfToken).Count(&locks)
+		assert.Equal(t, int64(1), locks)
+		mockDB.Model(&table.WorkflowActivatorLock{}).Where("token = ?", runToken).Count(&locks)
+		assert.Equal(t, int64(1), locks)
+		held := 0
+		scheduler.claims.Range(func(_, _ interface{}) bool {
+			held++
+			return true
+		})
+		assert.Equal(t, 0, held, "the locks are not refreshed anymore")
+	})
+
+	t.Run("Claiming stops", func(t *testing.T) {
+		scheduler := &Scheduler{ShutdownTimeout: 100 * time.Millisecond}
+		scheduler.shutdown(mockDB)
+		generation, activation := scheduler.pools()
+		assert.False(t, generation.submit("workflow:1", func(context.Context) {}))
+		assert.False(t, activation.submit("run:1", func(context.Context) {}))
+	})
+
+	cleanupDB(mockDB, dbName)
+}
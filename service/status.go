@@ -0,0 +1,56 @@
+// Copyright (c) 2022, Salesforce, Inc.
+// All rights reserved.
+// SPDX-License-Identifier: BSD-3-Clause
+// For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+
+package service
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"mce.salesforce.com/sprinkler/metrics"
+)
+
+type poolStatus struct {
+	Workers int `json:"workers"`
+	Busy    int `json:"busy"`
+	Queued  int `json:"queued"`
+}
+
+func (p *workerPool) status() poolStatus {
+	queued, busy := p.stats()
+	return poolStatus{Workers: p.size, Busy: busy, Queued: queued}
+}
+
+// statusRouter serves the scheduler status and metrics
+func (s *Scheduler) statusRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET("__status", func(c *gin.Context) {
+		generation, activation := s.pools()
+		c.JSON(http.StatusOK, gin.H{
+			"status":   "ok",
+			"instance": s.instanceID(),
+			"leader":   s.leaderStatus(),
+			"pools": gin.H{
+				poolGeneration: generation.status(),
+				poolActivation: activation.status(),
+			},
+		})
+	})
+	r.GET("__metrics", metrics.GinMetricsHandler)
+	return r
+}
+
+func (s *Scheduler) serveStatus(ctx context.Context) {
+	if s.Address == "" {
+		return
+	}
+	server := &http.Server{Addr: s.Address, Handler: s.statusRouter()}
+	if err := serve(ctx, server, s.shutdownTimeout()); err != nil {
+		log.Fatal(err)
+	}
+}